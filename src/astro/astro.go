@@ -0,0 +1,174 @@
+package astro
+
+import (
+	"math"
+	"time"
+)
+
+// Altitudes of the sun's centre in degrees. Sunrise and sunset allow for refraction and the radius
+// of the sun's disc
+const (
+	sunriseAltitude  = -0.833
+	civilAltitude    = -6.0
+	nauticalAltitude = -12.0
+)
+
+const (
+	julianUnixEpoch = 2440587.5 // Julian date of 1970-01-01 00:00 UTC
+	julian2000      = 2451545.0 // Julian date of 2000-01-01 12:00 UTC
+	obliquity       = 23.4397   // Tilt of the earth's axis in degrees
+)
+
+// Sun times of a day at a place. Events that do not happen that day (e.g. the sun does not set
+// during the midnight sun, or it never gets dark enough for nautical twilight) are zero
+type SunTimes struct {
+	Sunrise      time.Time
+	Sunset       time.Time
+	SolarNoon    time.Time
+	CivilDawn    time.Time
+	CivilDusk    time.Time
+	NauticalDawn time.Time
+	NauticalDusk time.Time
+	// The sun stays above (midnight sun) or below (polar night) the horizon all day
+	PolarDay   bool
+	PolarNight bool
+}
+
+// Time between sunrise and sunset, 24 hours during the midnight sun and none during the polar night
+func (s SunTimes) DayLength() time.Duration {
+	if s.PolarDay {
+		return 24 * time.Hour
+	} else if s.Sunrise.IsZero() || s.Sunset.IsZero() {
+		return 0
+	}
+	return s.Sunset.Sub(s.Sunrise)
+}
+
+// Sun times of a calendar day at a coordinate (longitude positive east), using the sunrise
+// equation: https://en.wikipedia.org/wiki/Sunrise_equation. The times are accurate to about a
+// minute and returned in UTC
+func Sun(year int, month time.Month, day int, lat float64, lon float64) SunTimes {
+	transit, declination := solarTransit(year, month, day, lon)
+	sun := SunTimes{SolarNoon: fromJulianDate(transit)}
+
+	var aboveAll, belowAll bool
+	sun.Sunrise, sun.Sunset, aboveAll, belowAll = crossing(transit, lat, declination, sunriseAltitude)
+	sun.PolarDay, sun.PolarNight = aboveAll, belowAll
+	sun.CivilDawn, sun.CivilDusk, _, _ = crossing(transit, lat, declination, civilAltitude)
+	sun.NauticalDawn, sun.NauticalDusk, _, _ = crossing(transit, lat, declination, nauticalAltitude)
+
+	return sun
+}
+
+// Julian date of the solar noon of a calendar day at a longitude, and the sun's declination in degrees
+func solarTransit(year int, month time.Month, day int, lon float64) (float64, float64) {
+	// Days since 2000-01-01 12:00 UTC, then the mean solar noon at this longitude
+	noon := time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+	days := math.Round(julianDate(noon) - julian2000)
+	meanNoon := days - lon/360
+
+	anomaly := normalize(357.5291 + 0.98560028*meanNoon)
+	center := 1.9148*sin(anomaly) + 0.0200*sin(2*anomaly) + 0.0003*sin(3*anomaly)
+	eclipticLongitude := normalize(anomaly + center + 180 + 102.9372)
+	transit := julian2000 + meanNoon + 0.0053*sin(anomaly) - 0.0069*sin(2*eclipticLongitude)
+	declination := asin(sin(eclipticLongitude) * sin(obliquity))
+	return transit, declination
+}
+
+// When the sun passes an altitude before and after its transit. When it never does that day, it
+// is reported whether the sun stays above or below it
+func crossing(transit float64, lat float64, declination float64, altitude float64) (time.Time, time.Time, bool, bool) {
+	cosHourAngle := (sin(altitude) - sin(lat)*sin(declination)) / (cos(lat) * cos(declination))
+	if cosHourAngle < -1 {
+		return time.Time{}, time.Time{}, true, false
+	} else if cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false, true
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	return fromJulianDate(transit - hourAngle/360), fromJulianDate(transit + hourAngle/360), false, false
+}
+
+func julianDate(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianUnixEpoch
+}
+
+func fromJulianDate(julian float64) time.Time {
+	return time.Unix(int64(math.Round((julian-julianUnixEpoch)*86400)), 0).UTC()
+}
+
+func normalize(degrees float64) float64 {
+	degrees = math.Mod(degrees, 360)
+	if degrees < 0 {
+		degrees += 360
+	}
+	return degrees
+}
+
+func sin(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+func cos(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180)
+}
+
+func asin(x float64) float64 {
+	return math.Asin(x) * 180 / math.Pi
+}
+
+// Altitudes of the sun in degrees that bound the golden hour (soft warm light, from -4 to 6) and
+// the blue hour (from -6 to -4), as photographers usually define them
+const (
+	goldenHourTop  = 6.0
+	blueHourTop    = -4.0
+	blueHourBottom = -6.0
+)
+
+// A span of time, zero when it does not happen that day
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (w Window) IsZero() bool {
+	return w.Start.IsZero() || w.End.IsZero()
+}
+
+// Golden and blue hours of a day, in the morning and the evening
+type LightWindows struct {
+	MorningBlueHour   Window
+	MorningGoldenHour Window
+	EveningGoldenHour Window
+	EveningBlueHour   Window
+}
+
+// Golden and blue hours of a calendar day at a coordinate, in UTC. When the sun never climbs above
+// the top of a window (e.g. in winter far north), the morning window ends and the evening window
+// starts at solar noon
+func Light(year int, month time.Month, day int, lat float64, lon float64) LightWindows {
+	transit, declination := solarTransit(year, month, day, lon)
+	return LightWindows{
+		MorningBlueHour:   lightWindow(transit, lat, declination, blueHourBottom, blueHourTop, true),
+		MorningGoldenHour: lightWindow(transit, lat, declination, blueHourTop, goldenHourTop, true),
+		EveningGoldenHour: lightWindow(transit, lat, declination, blueHourTop, goldenHourTop, false),
+		EveningBlueHour:   lightWindow(transit, lat, declination, blueHourBottom, blueHourTop, false),
+	}
+}
+
+// The time the sun spends between two altitudes while rising (morning) or setting
+func lightWindow(transit float64, lat float64, declination float64, bottom float64, top float64, morning bool) Window {
+	bottomDawn, bottomDusk, aboveBottom, belowBottom := crossing(transit, lat, declination, bottom)
+	if aboveBottom || belowBottom {
+		return Window{}
+	}
+	topDawn, topDusk, _, belowTop := crossing(transit, lat, declination, top)
+	if belowTop {
+		topDawn, topDusk = fromJulianDate(transit), fromJulianDate(transit)
+	}
+
+	if morning {
+		return Window{Start: bottomDawn, End: topDawn}
+	}
+	return Window{Start: topDusk, End: bottomDusk}
+}
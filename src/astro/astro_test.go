@@ -0,0 +1,144 @@
+package astro
+
+import (
+	"testing"
+	"time"
+)
+
+// Eastern Daylight Time, Toronto's zone in June
+var toronto = time.FixedZone("EDT", -4*3600)
+
+// Local time on the test's day, e.g. "05:36"
+func at(t *testing.T, location *time.Location, year int, month time.Month, day int, clock string) time.Time {
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Format("2006-01-02")+" "+clock, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// Times are accurate to about a minute, the references are rounded to the minute
+func near(got time.Time, want time.Time) bool {
+	difference := got.Sub(want)
+	return !got.IsZero() && difference > -2*time.Minute && difference < 2*time.Minute
+}
+
+// Toronto (43.65, -79.38) on 2024-06-21, from https://www.timeanddate.com/sun/canada/toronto?month=6&year=2024
+func TestSunMidLatitude(t *testing.T) {
+	sun := Sun(2024, time.June, 21, 43.65, -79.38)
+
+	tests := []struct {
+		name string
+		got  time.Time
+		want string
+	}{
+		{"NauticalDawn", sun.NauticalDawn, "04:13"},
+		{"CivilDawn", sun.CivilDawn, "05:00"},
+		{"Sunrise", sun.Sunrise, "05:36"},
+		{"SolarNoon", sun.SolarNoon, "13:19"},
+		{"Sunset", sun.Sunset, "21:02"},
+		{"CivilDusk", sun.CivilDusk, "21:39"},
+		{"NauticalDusk", sun.NauticalDusk, "22:25"},
+	}
+	for _, test := range tests {
+		if want := at(t, toronto, 2024, time.June, 21, test.want); !near(test.got, want) {
+			t.Errorf("%s = %s, want %s", test.name, test.got.In(toronto).Format("15:04:05"), test.want)
+		}
+	}
+
+	if sun.PolarDay || sun.PolarNight {
+		t.Errorf("PolarDay = %v, PolarNight = %v, want neither", sun.PolarDay, sun.PolarNight)
+	}
+	if length, want := sun.DayLength(), 15*time.Hour+26*time.Minute; length < want-2*time.Minute || length > want+2*time.Minute {
+		t.Errorf("DayLength() = %s, want about %s", length, want)
+	}
+}
+
+// Longyearbyen, Svalbard (78.22, 15.65) has the midnight sun in June and the polar night in December
+func TestSunPolar(t *testing.T) {
+	summer := Sun(2024, time.June, 21, 78.22, 15.65)
+	if !summer.PolarDay || summer.PolarNight {
+		t.Errorf("June: PolarDay = %v, PolarNight = %v, want the midnight sun", summer.PolarDay, summer.PolarNight)
+	}
+	for name, event := range map[string]time.Time{"Sunrise": summer.Sunrise, "Sunset": summer.Sunset,
+		"CivilDawn": summer.CivilDawn, "CivilDusk": summer.CivilDusk, "NauticalDawn": summer.NauticalDawn, "NauticalDusk": summer.NauticalDusk} {
+		if !event.IsZero() {
+			t.Errorf("June: %s = %s, want none", name, event)
+		}
+	}
+	if length := summer.DayLength(); length != 24*time.Hour {
+		t.Errorf("June: DayLength() = %s, want 24h", length)
+	}
+
+	winter := Sun(2024, time.December, 21, 78.22, 15.65)
+	if winter.PolarDay || !winter.PolarNight {
+		t.Errorf("December: PolarDay = %v, PolarNight = %v, want the polar night", winter.PolarDay, winter.PolarNight)
+	}
+	for name, event := range map[string]time.Time{"Sunrise": winter.Sunrise, "Sunset": winter.Sunset,
+		"CivilDawn": winter.CivilDawn, "CivilDusk": winter.CivilDusk} {
+		if !event.IsZero() {
+			t.Errorf("December: %s = %s, want none", name, event)
+		}
+	}
+	if length := winter.DayLength(); length != 0 {
+		t.Errorf("December: DayLength() = %s, want 0", length)
+	}
+	// At noon the sun is 11.7° below the horizon, so there is a short nautical twilight around it
+	if !winter.NauticalDawn.Before(winter.SolarNoon) || !winter.NauticalDusk.After(winter.SolarNoon) {
+		t.Errorf("December: nautical twilight from %s to %s, want it around solar noon at %s",
+			winter.NauticalDawn, winter.NauticalDusk, winter.SolarNoon)
+	}
+	if noon := at(t, time.UTC, 2024, time.December, 21, "10:56"); !near(winter.SolarNoon, noon) {
+		t.Errorf("December: SolarNoon = %s, want 10:56 UTC", winter.SolarNoon)
+	}
+}
+
+func TestLight(t *testing.T) {
+	// Toronto on 2024-06-21: the blue hours are civil twilight down to a sun 4° below the horizon,
+	// the golden hours run from there to 6° above it
+	sun := Sun(2024, time.June, 21, 43.65, -79.38)
+	light := Light(2024, time.June, 21, 43.65, -79.38)
+
+	tests := []struct {
+		name       string
+		window     Window
+		start, end string
+	}{
+		{"MorningBlueHour", light.MorningBlueHour, "05:00", "05:14"},
+		{"MorningGoldenHour", light.MorningGoldenHour, "05:14", "06:20"},
+		{"EveningGoldenHour", light.EveningGoldenHour, "20:19", "21:24"},
+		{"EveningBlueHour", light.EveningBlueHour, "21:24", "21:39"},
+	}
+	for _, test := range tests {
+		start, end := at(t, toronto, 2024, time.June, 21, test.start), at(t, toronto, 2024, time.June, 21, test.end)
+		if test.window.IsZero() || !near(test.window.Start, start) || !near(test.window.End, end) {
+			t.Errorf("%s = %s to %s, want %s to %s", test.name, test.window.Start.In(toronto).Format("15:04"),
+				test.window.End.In(toronto).Format("15:04"), test.start, test.end)
+		}
+	}
+	if !light.MorningBlueHour.Start.Equal(sun.CivilDawn) || !light.EveningBlueHour.End.Equal(sun.CivilDusk) {
+		t.Errorf("blue hours from %s and until %s, want civil dawn %s and dusk %s", light.MorningBlueHour.Start,
+			light.EveningBlueHour.End, sun.CivilDawn, sun.CivilDusk)
+	}
+	if !light.MorningBlueHour.End.Equal(light.MorningGoldenHour.Start) || !light.EveningGoldenHour.End.Equal(light.EveningBlueHour.Start) {
+		t.Errorf("the golden hours do not meet the blue hours: %+v", light)
+	}
+
+	// The sun stays above 6° in Longyearbyen's summer and below -6° in its winter
+	for _, month := range []time.Month{time.June, time.December} {
+		if light := Light(2024, month, 21, 78.22, 15.65); light != (LightWindows{}) {
+			t.Errorf("Longyearbyen in %s: %+v, want no golden or blue hours", month, light)
+		}
+	}
+
+	// At 65° N in December the sun climbs to 1.6°, so the golden hours meet at solar noon
+	winter := Sun(2024, time.December, 21, 65, 0)
+	light = Light(2024, time.December, 21, 65, 0)
+	if light.MorningBlueHour.IsZero() || light.EveningBlueHour.IsZero() {
+		t.Errorf("65° N in December: blue hours %+v and %+v, want both", light.MorningBlueHour, light.EveningBlueHour)
+	}
+	if !light.MorningGoldenHour.End.Equal(winter.SolarNoon) || !light.EveningGoldenHour.Start.Equal(winter.SolarNoon) {
+		t.Errorf("65° N in December: golden hours %+v and %+v, want them to meet at solar noon %s",
+			light.MorningGoldenHour, light.EveningGoldenHour, winter.SolarNoon)
+	}
+}
@@ -0,0 +1,196 @@
+package astro
+
+import (
+	"math"
+	"time"
+)
+
+// The moon's position and phase follow the low precision formulas of "Astronomy Answers"
+// (https://www.aa.quae.nl/en/reken/hemelpositie.html), as used by the suncalc library. Positions
+// are within a few tenths of a degree, enough for rise and set times to the minute or two
+
+const (
+	radians = math.Pi / 180
+	// Altitude of the moon's centre at rise and set, allowing for refraction and its radius
+	moonriseAltitude = 0.133 * radians
+	sunDistanceKm    = 149598000.0
+)
+
+// Phase names from new moon, in steps of an eighth of the cycle
+var phaseNames = []string{
+	"new_moon", "waxing_crescent", "first_quarter", "waxing_gibbous",
+	"full_moon", "waning_gibbous", "last_quarter", "waning_crescent",
+}
+
+// Phase and lit part of the moon at a moment
+type MoonPhase struct {
+	// 0 is new moon, 0.25 first quarter, 0.5 full moon and 0.75 last quarter
+	Phase float64
+	// Illuminated fraction of the disc, from 0 to 1
+	Fraction float64
+}
+
+// Name of the phase such as "waxing_gibbous", each name covers an eighth of the cycle around
+// its exact phase
+func (m MoonPhase) Name() string {
+	return phaseNames[int(math.Floor(m.Phase*8+0.5))%8]
+}
+
+// Moonrise and moonset during a day. The moon can also not rise or not set at all that day
+type MoonTimes struct {
+	Rise       time.Time
+	Set        time.Time
+	AlwaysUp   bool
+	AlwaysDown bool
+}
+
+func Moon(t time.Time) MoonPhase {
+	d := daysSince2000(t)
+	sunDeclination, sunAscension := sunCoords(d)
+	moonDeclination, moonAscension, moonDistance := moonCoords(d)
+
+	elongation := math.Acos(math.Sin(sunDeclination)*math.Sin(moonDeclination) +
+		math.Cos(sunDeclination)*math.Cos(moonDeclination)*math.Cos(sunAscension-moonAscension))
+	incidence := math.Atan2(sunDistanceKm*math.Sin(elongation), moonDistance-sunDistanceKm*math.Cos(elongation))
+	angle := math.Atan2(math.Cos(sunDeclination)*math.Sin(sunAscension-moonAscension),
+		math.Sin(sunDeclination)*math.Cos(moonDeclination)-math.Cos(sunDeclination)*math.Sin(moonDeclination)*math.Cos(sunAscension-moonAscension))
+
+	sign := 1.0
+	if angle < 0 {
+		sign = -1
+	}
+	return MoonPhase{
+		Phase:    0.5 + 0.5*incidence*sign/math.Pi,
+		Fraction: (1 + math.Cos(incidence)) / 2,
+	}
+}
+
+// Moonrise and moonset in the 24 hours from 'start', usually the local midnight of a day. The moon's
+// altitude is sampled every hour and a parabola is fitted through each three samples to find
+// where it crosses the horizon
+func MoonRiseSet(start time.Time, lat float64, lon float64) MoonTimes {
+	altitudeAt := func(hours float64) float64 {
+		return moonAltitude(start.Add(time.Duration(hours*float64(time.Hour))), lat, lon) - moonriseAltitude
+	}
+
+	var times MoonTimes
+	var rise, set float64
+	var hasRise, hasSet bool
+
+	h0 := altitudeAt(0)
+	for i := 1.0; i <= 24; i += 2 {
+		h1, h2 := altitudeAt(i), altitudeAt(i+1)
+
+		a := (h0+h2)/2 - h1
+		b := (h2 - h0) / 2
+		xe := -b / (2 * a)
+		peak := (a*xe+b)*xe + h1
+		discriminant := b*b - 4*a*h1
+
+		roots := 0
+		var x1, x2 float64
+		if discriminant >= 0 {
+			dx := math.Sqrt(discriminant) / (math.Abs(a) * 2)
+			x1, x2 = xe-dx, xe+dx
+			if math.Abs(x1) <= 1 {
+				roots++
+			}
+			if math.Abs(x2) <= 1 {
+				roots++
+			}
+			if x1 < -1 {
+				x1 = x2
+			}
+		}
+
+		if roots == 1 {
+			if h0 < 0 {
+				rise, hasRise = i+x1, true
+			} else {
+				set, hasSet = i+x1, true
+			}
+		} else if roots == 2 {
+			if peak < 0 {
+				rise, set = i+x2, i+x1
+			} else {
+				rise, set = i+x1, i+x2
+			}
+			hasRise, hasSet = true, true
+		}
+
+		if hasRise && hasSet {
+			break
+		}
+		h0 = h2
+	}
+
+	if hasRise {
+		times.Rise = start.Add(time.Duration(rise * float64(time.Hour))).UTC()
+	}
+	if hasSet {
+		times.Set = start.Add(time.Duration(set * float64(time.Hour))).UTC()
+	}
+	// Without a rise or a set every sample is on the same side of the horizon. The peak of the last
+	// parabola is not, it can lie far outside of its samples
+	if !hasRise && !hasSet {
+		times.AlwaysUp, times.AlwaysDown = h0 > 0, h0 <= 0
+	}
+	return times
+}
+
+// Altitude of the moon in radians above the horizon, corrected for refraction
+func moonAltitude(t time.Time, lat float64, lon float64) float64 {
+	d := daysSince2000(t)
+	declination, ascension, _ := moonCoords(d)
+	hourAngle := siderealTime(d, -lon*radians) - ascension
+	phi := lat * radians
+
+	altitude := math.Asin(math.Sin(phi)*math.Sin(declination) + math.Cos(phi)*math.Cos(declination)*math.Cos(hourAngle))
+	return altitude + refraction(altitude)
+}
+
+// Declination and right ascension of the sun in radians
+func sunCoords(d float64) (float64, float64) {
+	anomaly := radians * (357.5291 + 0.98560028*d)
+	center := radians * (1.9148*math.Sin(anomaly) + 0.02*math.Sin(2*anomaly) + 0.0003*math.Sin(3*anomaly))
+	longitude := anomaly + center + radians*102.9372 + math.Pi
+	return equatorial(longitude, 0)
+}
+
+// Declination and right ascension in radians and the distance in km of the moon
+func moonCoords(d float64) (float64, float64, float64) {
+	meanLongitude := radians * (218.316 + 13.176396*d)
+	anomaly := radians * (134.963 + 13.064993*d)
+	meanDistance := radians * (93.272 + 13.229350*d)
+
+	longitude := meanLongitude + radians*6.289*math.Sin(anomaly)
+	latitude := radians * 5.128 * math.Sin(meanDistance)
+	distance := 385001 - 20905*math.Cos(anomaly)
+
+	declination, ascension := equatorial(longitude, latitude)
+	return declination, ascension, distance
+}
+
+// Ecliptic to equatorial coordinates, all in radians
+func equatorial(longitude float64, latitude float64) (float64, float64) {
+	e := radians * obliquity
+	declination := math.Asin(math.Sin(latitude)*math.Cos(e) + math.Cos(latitude)*math.Sin(e)*math.Sin(longitude))
+	ascension := math.Atan2(math.Sin(longitude)*math.Cos(e)-math.Tan(latitude)*math.Sin(e), math.Cos(longitude))
+	return declination, ascension
+}
+
+func siderealTime(d float64, lw float64) float64 {
+	return radians*(280.16+360.9856235*d) - lw
+}
+
+// Atmospheric refraction in radians for an altitude in radians
+func refraction(altitude float64) float64 {
+	if altitude < 0 {
+		altitude = 0
+	}
+	return 0.0002967 / math.Tan(altitude+0.00312536/(altitude+0.08901179))
+}
+
+func daysSince2000(t time.Time) float64 {
+	return julianDate(t) - julian2000
+}
@@ -0,0 +1,138 @@
+package astro
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Phases of April 2024 from https://www.timeanddate.com/moon/phases/?year=2024, in UTC
+func TestMoon(t *testing.T) {
+	tests := []struct {
+		moment   string
+		phase    float64
+		fraction float64
+		name     string
+	}{
+		{"2024-04-08T18:21:00Z", 0, 0, "new_moon"},
+		{"2024-04-15T19:13:00Z", 0.25, 0.5, "first_quarter"},
+		{"2024-04-23T23:49:00Z", 0.5, 1, "full_moon"},
+		{"2024-05-01T11:27:00Z", 0.75, 0.5, "last_quarter"},
+	}
+
+	for _, test := range tests {
+		moment, err := time.Parse(time.RFC3339, test.moment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		moon := Moon(moment)
+		// The phase wraps around at new moon
+		phase := math.Abs(moon.Phase - test.phase)
+		if phase > 0.5 {
+			phase = 1 - phase
+		}
+		if phase > 0.01 || math.Abs(moon.Fraction-test.fraction) > 0.02 || moon.Name() != test.name {
+			t.Errorf("Moon(%s) = %.3f, %.1f%% lit, %q, want %.2f, %.0f%% lit, %q", test.moment, moon.Phase,
+				moon.Fraction*100, moon.Name(), test.phase, test.fraction*100, test.name)
+		}
+	}
+}
+
+func TestMoonPhaseName(t *testing.T) {
+	tests := []struct {
+		phase float64
+		name  string
+	}{
+		{0, "new_moon"},
+		{0.0624, "new_moon"},
+		{0.0625, "waxing_crescent"},
+		{0.1874, "waxing_crescent"},
+		{0.1875, "first_quarter"},
+		{0.3125, "waxing_gibbous"},
+		{0.4375, "full_moon"},
+		{0.5, "full_moon"},
+		{0.5625, "waning_gibbous"},
+		{0.6875, "last_quarter"},
+		{0.8125, "waning_crescent"},
+		{0.9374, "waning_crescent"},
+		{0.9375, "new_moon"},
+		{0.9999, "new_moon"},
+	}
+
+	for _, test := range tests {
+		if name := (MoonPhase{Phase: test.phase}).Name(); name != test.name {
+			t.Errorf("MoonPhase{Phase: %v}.Name() = %q, want %q", test.phase, name, test.name)
+		}
+	}
+}
+
+// Rise and set found by sampling the altitude every minute, to check MoonRiseSet() against
+func moonRiseSetByMinute(start time.Time, lat float64, lon float64) MoonTimes {
+	var times MoonTimes
+	above := moonAltitude(start, lat, lon) > moonriseAltitude
+	up, down := above, !above
+	for minute := 1; minute <= 24*60; minute++ {
+		moment := start.Add(time.Duration(minute) * time.Minute)
+		nowAbove := moonAltitude(moment, lat, lon) > moonriseAltitude
+		if nowAbove && !above && times.Rise.IsZero() {
+			times.Rise = moment.UTC()
+		} else if !nowAbove && above && times.Set.IsZero() {
+			times.Set = moment.UTC()
+		}
+		above = nowAbove
+		up, down = up && above, down && !above
+	}
+	times.AlwaysUp, times.AlwaysDown = up, down
+	return times
+}
+
+func TestMoonRiseSet(t *testing.T) {
+	near := func(got time.Time, want time.Time) bool {
+		if got.IsZero() || want.IsZero() {
+			return got.IsZero() && want.IsZero()
+		}
+		difference := got.Sub(want)
+		return difference > -3*time.Minute && difference < 3*time.Minute
+	}
+
+	// Every day of a month in Toronto, and in Longyearbyen, where the moon stays up or down for days
+	places := []struct {
+		name     string
+		lat, lon float64
+		zone     *time.Location
+	}{
+		{"Toronto", 43.65, -79.38, time.FixedZone("EDT", -4*3600)},
+		{"Longyearbyen", 78.22, 15.65, time.FixedZone("CET", 3600)},
+	}
+	for _, place := range places {
+		for day := 1; day <= 31; day++ {
+			start := time.Date(2024, time.March, day, 0, 0, 0, 0, place.zone)
+			got, want := MoonRiseSet(start, place.lat, place.lon), moonRiseSetByMinute(start, place.lat, place.lon)
+			if !near(got.Rise, want.Rise) || !near(got.Set, want.Set) || got.AlwaysUp != want.AlwaysUp || got.AlwaysDown != want.AlwaysDown {
+				t.Errorf("MoonRiseSet(%s, %s) = %+v, want %+v", start.Format("2006-01-02"), place.name, got, want)
+			}
+		}
+	}
+
+	// Longyearbyen in March 2024: the moon rises on the 12th and stays up until it sets on the 27th
+	tests := []struct {
+		day                  int
+		rise, set            bool
+		alwaysUp, alwaysDown bool
+	}{
+		{5, false, false, false, true},
+		{10, true, true, false, false},
+		{12, true, false, false, false},
+		{16, false, false, true, false},
+		{27, false, true, false, false},
+		{30, false, false, false, true},
+	}
+	for _, test := range tests {
+		times := MoonRiseSet(time.Date(2024, time.March, test.day, 0, 0, 0, 0, time.UTC), 78.22, 15.65)
+		if !times.Rise.IsZero() != test.rise || !times.Set.IsZero() != test.set ||
+			times.AlwaysUp != test.alwaysUp || times.AlwaysDown != test.alwaysDown {
+			t.Errorf("MoonRiseSet(2024-03-%02d, Longyearbyen) = %+v, want rise %v, set %v, always up %v, always down %v",
+				test.day, times, test.rise, test.set, test.alwaysUp, test.alwaysDown)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package chart
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	marginLeft   = 55
+	marginRight  = 15
+	marginTop    = 30
+	marginBottom = 30
+	// Points are drawn as dots as well when there are fewer than this, so single observations show up
+	maxDots = 100
+)
+
+// A value at a Unix time
+type Point struct {
+	Time  int64
+	Value float64
+}
+
+// Line chart of a single series over a fixed time window, rendered as an inline SVG element
+type LineChart struct {
+	Title  string
+	Unit   string
+	Color  string // Any SVG colour, e.g. "#d9534f"
+	Width  int
+	Height int
+	// The time window shown on the x axis, points outside of it are left out
+	From   int64
+	To     int64
+	Points []Point
+	// Seconds east of UTC of the zone the times are shown in, usually the city's
+	Timezone int
+	// Shown instead of the line when there are no points
+	EmptyText string
+}
+
+// Render the chart as an <svg> element. All text is escaped, so the result can be embedded in HTML
+// as is. Points further apart than usual are not joined, so gaps in the data stay visible
+func (c LineChart) SVG() string {
+	width, height := c.Width, c.Height
+	if width == 0 {
+		width = 720
+	}
+	if height == 0 {
+		height = 240
+	}
+	plotWidth := float64(width - marginLeft - marginRight)
+	plotHeight := float64(height - marginTop - marginBottom)
+
+	var points []Point
+	for _, point := range c.Points {
+		if point.Time >= c.From && point.Time <= c.To && !math.IsNaN(point.Value) {
+			points = append(points, point)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" style="max-width:%dpx" role="img" aria-label="%s" font-family="sans-serif" font-size="11">`,
+		width, height, width, html.EscapeString(c.Title))
+	fmt.Fprintf(&svg, `<text x="%d" y="18" font-size="14" font-weight="bold">%s</text>`, marginLeft, html.EscapeString(c.title()))
+	fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="%.0f" height="%.0f" fill="none" stroke="#ccc"/>`, marginLeft, marginTop, plotWidth, plotHeight)
+
+	if len(points) == 0 || c.To <= c.From {
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="#777">%s</text></svg>`,
+			float64(marginLeft)+plotWidth/2, float64(marginTop)+plotHeight/2, html.EscapeString(c.EmptyText))
+		return svg.String()
+	}
+
+	low, high, step := valueAxis(points)
+	x := func(t int64) float64 {
+		return float64(marginLeft) + float64(t-c.From)/float64(c.To-c.From)*plotWidth
+	}
+	y := func(value float64) float64 {
+		return float64(marginTop) + (high-value)/(high-low)*plotHeight
+	}
+
+	// Value axis with grid lines
+	decimals := stepDecimals(step)
+	for value := low; value <= high+step/2; value += step {
+		fmt.Fprintf(&svg, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#eee"/>`, marginLeft, y(value), float64(marginLeft)+plotWidth, y(value))
+		fmt.Fprintf(&svg, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`,
+			marginLeft-5, y(value), strconv.FormatFloat(value, 'f', decimals, 64))
+	}
+
+	// Time axis, the ticks fall on round hours or midnights of the zone
+	zone := time.FixedZone("", c.Timezone)
+	tickStep, layout := timeAxis(c.To - c.From)
+	local := c.From + int64(c.Timezone)
+	for tick := c.From - (local%tickStep+tickStep)%tickStep + tickStep; tick < c.To; tick += tickStep {
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#ccc"/>`, x(tick), marginTop, x(tick), float64(marginTop)+plotHeight+4)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`,
+			x(tick), float64(marginTop)+plotHeight+16, time.Unix(tick, 0).In(zone).Format(layout))
+	}
+
+	color := c.Color
+	if color == "" {
+		color = "#337ab7"
+	}
+
+	// The line is broken wherever two points are much further apart than usual
+	maxGap := gapThreshold(points, c.To-c.From)
+	var path strings.Builder
+	for i, point := range points {
+		command := "L"
+		if i == 0 || point.Time-points[i-1].Time > maxGap {
+			command = "M"
+		}
+		fmt.Fprintf(&path, "%s%.1f %.1f ", command, x(point.Time), y(point.Value))
+	}
+	fmt.Fprintf(&svg, `<path d="%s" fill="none" stroke="%s" stroke-width="2" stroke-linejoin="round"/>`,
+		strings.TrimSpace(path.String()), html.EscapeString(color))
+
+	if len(points) < maxDots {
+		for _, point := range points {
+			fmt.Fprintf(&svg, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="%s"><title>%s %s</title></circle>`,
+				x(point.Time), y(point.Value), html.EscapeString(color),
+				time.Unix(point.Time, 0).In(zone).Format("2 Jan 15:04"), html.EscapeString(c.format(point.Value)))
+		}
+	}
+
+	svg.WriteString(`</svg>`)
+	return svg.String()
+}
+
+func (c LineChart) title() string {
+	if c.Unit == "" {
+		return c.Title
+	}
+	return c.Title + " (" + c.Unit + ")"
+}
+
+func (c LineChart) format(value float64) string {
+	return strings.TrimSpace(strconv.FormatFloat(value, 'f', -1, 32) + " " + c.Unit)
+}
+
+// A range around the values that starts and ends on a round step, with about five steps
+func valueAxis(points []Point) (float64, float64, float64) {
+	low, high := points[0].Value, points[0].Value
+	for _, point := range points {
+		low = math.Min(low, point.Value)
+		high = math.Max(high, point.Value)
+	}
+	if high-low < 1e-9 {
+		low, high = low-1, high+1
+	}
+
+	step := niceStep((high - low) / 5)
+	return math.Floor(low/step) * step, math.Ceil(high/step) * step, step
+}
+
+// Round a step up to 1, 2, 2.5 or 5 times a power of ten
+func niceStep(raw float64) float64 {
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, multiple := range []float64{1, 2, 2.5, 5} {
+		if raw <= multiple*magnitude {
+			return multiple * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func stepDecimals(step float64) int {
+	decimals := 0
+	for step < 1 && decimals < 4 {
+		step *= 10
+		decimals++
+	}
+	// 2.5, 0.25, ...
+	if math.Abs(step-math.Round(step)) > 1e-9 {
+		decimals++
+	}
+	return decimals
+}
+
+// Tick spacing in seconds and the time layout of its labels, for at most seven ticks
+func timeAxis(span int64) (int64, string) {
+	const hour = 3600
+	for _, step := range []int64{hour, 3 * hour, 6 * hour, 12 * hour} {
+		if span/step <= 7 {
+			return step, "15:04"
+		}
+	}
+	for _, step := range []int64{24 * hour, 2 * 24 * hour, 7 * 24 * hour, 14 * 24 * hour, 30 * 24 * hour} {
+		if span/step <= 7 {
+			return step, "2 Jan"
+		}
+	}
+	return 61 * 24 * hour, "Jan 2006"
+}
+
+// Two points are joined unless they are more than three times the median interval apart. Short
+// breaks, relative to the window, are always joined
+func gapThreshold(points []Point, span int64) int64 {
+	if len(points) < 2 {
+		return span
+	}
+
+	intervals := make([]int64, 0, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		intervals = append(intervals, points[i].Time-points[i-1].Time)
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+
+	threshold := 3 * intervals[len(intervals)/2]
+	if minimum := span / 24; threshold < minimum {
+		threshold = minimum
+	}
+	return threshold
+}
@@ -0,0 +1,141 @@
+package chart
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSVGEscapesText(t *testing.T) {
+	svg := LineChart{
+		Title:     `Temperature <script>alert("x")</script>`,
+		Unit:      "°C & more",
+		Color:     `red"/><script>`,
+		From:      0,
+		To:        3600,
+		Points:    []Point{{0, 1}, {1800, 2}},
+		EmptyText: "<none>",
+	}.SVG()
+
+	if strings.Contains(svg, "<script>") || strings.Contains(svg, `red"`) {
+		t.Errorf("SVG() does not escape its text: %s", svg)
+	}
+	if !strings.Contains(svg, "Temperature &lt;script&gt;") || !strings.Contains(svg, "°C &amp; more") {
+		t.Errorf("SVG() does not show the escaped title and unit: %s", svg)
+	}
+
+	empty := LineChart{Title: "Humidity", From: 0, To: 3600, EmptyText: "No <observations>"}.SVG()
+	if !strings.Contains(empty, "No &lt;observations&gt;") {
+		t.Errorf("SVG() without points does not show the escaped empty text: %s", empty)
+	}
+}
+
+// A single point or a flat series has no range of values, the axis is widened instead of dividing by zero
+func TestSVGWithoutRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []Point
+	}{
+		{"single point", []Point{{1800, -3}}},
+		{"all equal", []Point{{0, 5}, {1200, 5}, {2400, 5}}},
+	}
+
+	for _, test := range tests {
+		svg := LineChart{Title: "Pressure", From: 0, To: 3600, Points: test.points}.SVG()
+		if strings.Contains(svg, "NaN") || strings.Contains(svg, "Inf") {
+			t.Errorf("%s: %s", test.name, svg)
+		}
+		if circles := strings.Count(svg, "<circle"); circles != len(test.points) {
+			t.Errorf("%s: %d dots, want %d", test.name, circles, len(test.points))
+		}
+	}
+}
+
+// The lowest and highest value of the axis are at the bottom and top of the plot, and the time
+// window spans its width
+func TestSVGScale(t *testing.T) {
+	svg := LineChart{
+		Title: "Temperature", Width: 720, Height: 240, From: 0, To: 100,
+		Points: []Point{{0, 0}, {50, 5}, {100, 10}, {150, 100}},
+	}.SVG()
+
+	// The plot is 650 by 180 from (55, 30), the point at 150 is outside of the window
+	for _, want := range []string{`<circle cx="55.0" cy="210.0"`, `<circle cx="380.0" cy="120.0"`, `<circle cx="705.0" cy="30.0"`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG() has no %s: %s", want, svg)
+		}
+	}
+	if strings.Count(svg, "<circle") != 3 {
+		t.Errorf("SVG() shows a point outside of the window: %s", svg)
+	}
+}
+
+func TestValueAxis(t *testing.T) {
+	tests := []struct {
+		values []float64
+		low    float64
+		high   float64
+		step   float64
+	}{
+		{[]float64{0, 10}, 0, 10, 2},
+		{[]float64{12.3, 17.8, 15}, 12, 18, 2},
+		{[]float64{1003.5, 1021.2}, 1000, 1025, 5},
+		{[]float64{0.12, 0.31}, 0.1, 0.35, 0.05},
+		// No range, the axis is widened by one either way
+		{[]float64{5, 5}, 4, 6, 0.5},
+		{[]float64{-3}, -4, -2, 0.5},
+	}
+
+	for _, test := range tests {
+		var points []Point
+		for i, value := range test.values {
+			points = append(points, Point{int64(i), value})
+		}
+		low, high, step := valueAxis(points)
+		if !near(low, test.low) || !near(high, test.high) || !near(step, test.step) {
+			t.Errorf("valueAxis(%v) = %v, %v, %v, want %v, %v, %v", test.values, low, high, step, test.low, test.high, test.step)
+		}
+	}
+}
+
+func TestStepDecimals(t *testing.T) {
+	tests := []struct {
+		step float64
+		want int
+	}{
+		{5, 0},
+		{2.5, 1},
+		{0.5, 1},
+		{0.25, 2},
+		{0.05, 2},
+	}
+
+	for _, test := range tests {
+		if got := stepDecimals(test.step); got != test.want {
+			t.Errorf("stepDecimals(%v) = %d, want %d", test.step, got, test.want)
+		}
+	}
+}
+
+func near(a float64, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+// Ticks and tooltips are in the zone of the chart, e.g. Toronto's in summer, 4 hours behind UTC
+func TestSVGTimezone(t *testing.T) {
+	const from = 1718928000 // 2024-06-21 00:00 UTC
+	svg := LineChart{
+		Title: "Temperature", Width: 720, Height: 240, From: from, To: from + 24*3600, Timezone: -4 * 3600,
+		Points: []Point{{from + 12*3600, 20}},
+	}.SVG()
+
+	// The plot is 650 wide from 55, local midnight is at 04:00 UTC and the ticks are 6 hours apart
+	for _, want := range []string{`x="163.3" y="226.0" text-anchor="middle">00:00<`, `x="325.8" y="226.0" text-anchor="middle">06:00<`,
+		`x="650.8" y="226.0" text-anchor="middle">18:00<`, `<title>21 Jun 08:00 20</title>`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG() has no %s: %s", want, svg)
+		}
+	}
+	if strings.Count(svg, `text-anchor="middle">`) != 4 {
+		t.Errorf("SVG() does not have 4 ticks: %s", svg)
+	}
+}
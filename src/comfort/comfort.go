@@ -0,0 +1,100 @@
+package comfort
+
+import (
+	"definition"
+	"math"
+)
+
+const (
+	// The heat index is only meaningful from 80 °F (26.7 °C) and the wind chill up to 10 °C with more
+	// than 4.8 km/h of wind, outside of that they are not reported
+	heatIndexMinCelsius = 26.7
+	windChillMaxCelsius = 10.0
+	windChillMinKmh     = 4.8
+)
+
+// Derived metrics of a weather result that is in metric units (°C and m/s). Nil is returned when
+// the temperature or humidity is missing
+func Metrics(main *definition.Main, wind *definition.Wind) *definition.Comfort {
+	if main == nil || main.Humidity <= 0 {
+		return nil
+	}
+
+	temp := float64(main.Temp)
+	humidity := float64(main.Humidity)
+	windKmh := 0.0
+	if wind != nil {
+		windKmh = float64(wind.Speed) * 3.6
+	}
+
+	metrics := &definition.Comfort{
+		FeelsLike: round(ApparentTemperature(temp, humidity, windKmh)),
+		DewPoint:  round(DewPoint(temp, humidity)),
+	}
+	if temp >= heatIndexMinCelsius {
+		heatIndex := round(HeatIndex(temp, humidity))
+		metrics.HeatIndex = &heatIndex
+	}
+	if temp <= windChillMaxCelsius && windKmh > windChillMinKmh {
+		windChill := round(WindChill(temp, windKmh))
+		metrics.WindChill = &windChill
+	}
+	return metrics
+}
+
+// How warm or cold it feels, as the US National Weather Service reports it: the wind chill when it
+// is cold and windy, the heat index when it is hot and the air temperature otherwise
+func ApparentTemperature(celsius float64, humidity float64, windKmh float64) float64 {
+	if celsius <= windChillMaxCelsius && windKmh > windChillMinKmh {
+		return WindChill(celsius, windKmh)
+	} else if celsius >= heatIndexMinCelsius {
+		return HeatIndex(celsius, humidity)
+	}
+	return celsius
+}
+
+// Heat index in °C with the Rothfusz regression and the NWS adjustments for low and high humidity:
+// https://www.wpc.ncep.noaa.gov/html/heatindex_equation.shtml
+// Reference values from the NWS heat index chart: 90 °F at 70% is 106 °F, 96 °F at 65% is 121 °F
+// and 100 °F at 40% is 109 °F
+func HeatIndex(celsius float64, humidity float64) float64 {
+	t := celsius*9/5 + 32
+	rh := humidity
+
+	// Steadman's simple formula, which the regression is not fitted for below 80 °F
+	heatIndex := 0.5 * (t + 61.0 + (t-68.0)*1.2 + rh*0.094)
+	if (heatIndex+t)/2 >= 80 {
+		heatIndex = -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+			0.00683783*t*t - 0.05481717*rh*rh + 0.00122874*t*t*rh +
+			0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+
+		if rh < 13 && t >= 80 && t <= 112 {
+			heatIndex -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		} else if rh > 85 && t >= 80 && t <= 87 {
+			heatIndex += (rh - 85) / 10 * (87 - t) / 5
+		}
+	}
+
+	return (heatIndex - 32) * 5 / 9
+}
+
+// Wind chill in °C with the formula used in Canada and the US since 2001:
+// https://www.weather.gov/media/epz/wxcalc/windChill.pdf
+// Reference values from Environment Canada's wind chill table: -10 °C with 20 km/h is -18 and
+// -20 °C with 30 km/h is -33. From the NWS chart: 0 °F (-17.8 °C) with 15 mph (24.1 km/h) is -19 °F
+func WindChill(celsius float64, windKmh float64) float64 {
+	v := math.Pow(windKmh, 0.16)
+	return 13.12 + 0.6215*celsius - 11.37*v + 0.3965*celsius*v
+}
+
+// Dew point in °C with the Magnus formula and the coefficients of Alduchov and Eskridge (1996).
+// Reference values: 25 °C at 60% is 16.7 °C and 10 °C at 80% is 6.7 °C
+func DewPoint(celsius float64, humidity float64) float64 {
+	const a, b = 17.625, 243.04
+	gamma := math.Log(humidity/100) + a*celsius/(b+celsius)
+	return b * gamma / (a - gamma)
+}
+
+func round(value float64) float32 {
+	return float32(math.Round(value*10) / 10)
+}
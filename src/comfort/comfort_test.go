@@ -0,0 +1,137 @@
+package comfort
+
+import (
+	"definition"
+	"math"
+	"testing"
+)
+
+func fahrenheit(celsius float64) float64 {
+	return celsius*9/5 + 32
+}
+
+func celsius(fahrenheit float64) float64 {
+	return (fahrenheit - 32) * 5 / 9
+}
+
+// From the NWS heat index chart, https://www.weather.gov/safety/heat-index. The chart is rounded
+// to whole °F
+func TestHeatIndex(t *testing.T) {
+	tests := []struct {
+		tempF, humidity, wantF float64
+	}{
+		{80, 40, 80},
+		{90, 50, 95},
+		{90, 70, 106},
+		{86, 90, 105},
+		{96, 65, 121},
+		{100, 40, 109},
+		{100, 50, 118},
+		{104, 55, 137},
+	}
+
+	for _, test := range tests {
+		got := fahrenheit(HeatIndex(celsius(test.tempF), test.humidity))
+		if math.Abs(got-test.wantF) > 1 {
+			t.Errorf("HeatIndex(%v °F, %v%%) = %.1f °F, want %v °F", test.tempF, test.humidity, got, test.wantF)
+		}
+	}
+}
+
+// From Environment Canada's wind chill table, https://www.canada.ca/en/environment-climate-change/services/weather-health/wind-chill-cold-weather/wind-chill-index.html,
+// rounded to whole °C
+func TestWindChillCelsius(t *testing.T) {
+	tests := []struct {
+		temp, windKmh, want float64
+	}{
+		{5, 5, 4},
+		{0, 10, -3},
+		{-5, 40, -14},
+		{-10, 20, -18},
+		{-20, 30, -33},
+		{-30, 50, -49},
+		{-40, 60, -64},
+	}
+
+	for _, test := range tests {
+		got := WindChill(test.temp, test.windKmh)
+		if math.Abs(got-test.want) > 0.6 {
+			t.Errorf("WindChill(%v °C, %v km/h) = %.1f °C, want %v °C", test.temp, test.windKmh, got, test.want)
+		}
+	}
+}
+
+// From the NWS wind chill chart, https://www.weather.gov/safety/cold-wind-chill-chart, rounded to
+// whole °F
+func TestWindChillFahrenheit(t *testing.T) {
+	tests := []struct {
+		tempF, windMph, wantF float64
+	}{
+		{40, 5, 36},
+		{30, 10, 21},
+		{20, 40, -1},
+		{0, 15, -19},
+		{-10, 20, -35},
+		{-25, 60, -69},
+	}
+
+	for _, test := range tests {
+		got := fahrenheit(WindChill(celsius(test.tempF), test.windMph*1.609344))
+		if math.Abs(got-test.wantF) > 0.6 {
+			t.Errorf("WindChill(%v °F, %v mph) = %.1f °F, want %v °F", test.tempF, test.windMph, got, test.wantF)
+		}
+	}
+}
+
+// Reference values of the Magnus formula with the Alduchov and Eskridge coefficients
+func TestDewPoint(t *testing.T) {
+	tests := []struct {
+		temp, humidity, want float64
+	}{
+		{25, 60, 16.7},
+		{10, 80, 6.7},
+		{30, 50, 18.4},
+		{20, 100, 20},
+	}
+
+	for _, test := range tests {
+		got := DewPoint(test.temp, test.humidity)
+		if math.Abs(got-test.want) > 0.1 {
+			t.Errorf("DewPoint(%v °C, %v%%) = %.2f °C, want %v °C", test.temp, test.humidity, got, test.want)
+		}
+	}
+}
+
+// The heat index and wind chill are only reported in their ranges, the feels-like temperature
+// picks the one that applies
+func TestMetrics(t *testing.T) {
+	if Metrics(nil, nil) != nil {
+		t.Errorf("Metrics(nil, nil) is not nil")
+	}
+	if Metrics(&definition.Main{Temp: 20}, nil) != nil {
+		t.Errorf("Metrics() without humidity is not nil")
+	}
+
+	mild := Metrics(&definition.Main{Temp: 20, Humidity: 50}, &definition.Wind{Speed: 5})
+	if mild.HeatIndex != nil || mild.WindChill != nil || mild.FeelsLike != 20 {
+		t.Errorf("Metrics(20 °C) = %+v, want only the air temperature", mild)
+	}
+
+	// 96 °F at 65%
+	hot := Metrics(&definition.Main{Temp: float32(celsius(96)), Humidity: 65}, nil)
+	if hot.HeatIndex == nil || hot.WindChill != nil || hot.FeelsLike != *hot.HeatIndex {
+		t.Errorf("Metrics(96 °F) = %+v, want the heat index", hot)
+	}
+
+	// 20 km/h is 5.56 m/s
+	cold := Metrics(&definition.Main{Temp: -10, Humidity: 70}, &definition.Wind{Speed: 20 / 3.6})
+	if cold.WindChill == nil || cold.HeatIndex != nil || cold.FeelsLike != *cold.WindChill ||
+		math.Abs(float64(*cold.WindChill)+18) > 0.6 {
+		t.Errorf("Metrics(-10 °C, 20 km/h) = %+v, want a wind chill of -18 °C", cold)
+	}
+
+	calm := Metrics(&definition.Main{Temp: -10, Humidity: 70}, &definition.Wind{Speed: 1})
+	if calm.WindChill != nil || calm.FeelsLike != -10 {
+		t.Errorf("Metrics(-10 °C, 3.6 km/h) = %+v, want no wind chill", calm)
+	}
+}
@@ -17,6 +17,19 @@ type CurrentWeather struct {
 	Name    string     `json:"name,omitempty"`
 	Code    int     `json:"cod"`
 	Message string     `json:"message,omitempty"`
+	Provider string    `json:"provider,omitempty"`
+	Units   *Units     `json:"units,omitempty"`
+	AirQuality *AirQuality `json:"air_quality,omitempty"`
+	Alerts  []*Alert   `json:"alerts,omitempty"`
+	Comfort *Comfort   `json:"comfort,omitempty"`
+	// Offset of the city's local time from UTC in seconds
+	Timezone int       `json:"timezone"`
+	Daylight *Daylight `json:"daylight,omitempty"`
+	Astronomy *Astronomy `json:"astronomy,omitempty"`
+	// Set when the lookup failed upstream, e.g. the API quota was used up or the weather services
+	// are down, and an earlier cached result is returned instead. A location that is not found is
+	// never answered from the cache
+	Stale   bool       `json:"stale,omitempty"`
 	UserStatus string `json:"-"`
 }
 
@@ -30,6 +43,88 @@ type Weather struct {
 	Main        string `json:"main,omitempty"`
 	Description string `json:"description,omitempty"`
 	Icon        string `json:"icon,omitempty"`
+	// Set by providers that only report a code, to the message of the description in the catalogs
+	// after "condition.", e.g. "clear_sky". The handlers translate it into 'Description'
+	DescriptionKey string `json:"-"`
+}
+
+// Air pollution at a coordinate: https://openweathermap.org/api/air-pollution
+type AirQuality struct {
+	Aqi        int            `json:"aqi"` // 1 = Good, 2 = Fair, 3 = Moderate, 4 = Poor, 5 = Very Poor
+	Components *AirComponents `json:"components,omitempty"`
+	Dt         int            `json:"dt,omitempty"`
+	// Set when an earlier cached result is returned, as for CurrentWeather
+	Stale      bool           `json:"stale,omitempty"`
+}
+
+// How the weather feels, derived from the temperature, humidity and wind. The heat index is only
+// set when it is hot and the wind chill only when it is cold and windy
+type Comfort struct {
+	FeelsLike float32  `json:"feels_like"`
+	DewPoint  float32  `json:"dew_point"`
+	HeatIndex *float32 `json:"heat_index,omitempty"`
+	WindChill *float32 `json:"wind_chill,omitempty"`
+}
+
+// Sun times of the observation's local day as Unix times, worked out from the coordinates. Events
+// that do not happen that day (e.g. sunset during the midnight sun) are left out
+type Daylight struct {
+	Sunrise      int  `json:"sunrise,omitempty"`
+	Sunset       int  `json:"sunset,omitempty"`
+	SolarNoon    int  `json:"solar_noon"`
+	DayLength    int  `json:"day_length"` // Seconds
+	CivilDawn    int  `json:"civil_dawn,omitempty"`
+	CivilDusk    int  `json:"civil_dusk,omitempty"`
+	NauticalDawn int  `json:"nautical_dawn,omitempty"`
+	NauticalDusk int  `json:"nautical_dusk,omitempty"`
+	PolarDay     bool `json:"polar_day,omitempty"`
+	PolarNight   bool `json:"polar_night,omitempty"`
+}
+
+// Moon and photography light of the observation's local day, worked out from the coordinates. Times
+// are Unix times and left out when they do not happen that day
+type Astronomy struct {
+	MoonPhase         float32     `json:"moon_phase"`      // 0 = new moon, 0.25 = first quarter, 0.5 = full moon, 0.75 = last quarter
+	MoonPhaseName     string      `json:"moon_phase_name"` // e.g. waxing_crescent
+	MoonIllumination  int         `json:"moon_illumination"` // Percent of the disc that is lit
+	Moonrise          int         `json:"moonrise,omitempty"`
+	Moonset           int         `json:"moonset,omitempty"`
+	MoonAlwaysUp      bool        `json:"moon_always_up,omitempty"`
+	MoonAlwaysDown    bool        `json:"moon_always_down,omitempty"`
+	MorningBlueHour   *TimeWindow `json:"morning_blue_hour,omitempty"`
+	MorningGoldenHour *TimeWindow `json:"morning_golden_hour,omitempty"`
+	EveningGoldenHour *TimeWindow `json:"evening_golden_hour,omitempty"`
+	EveningBlueHour   *TimeWindow `json:"evening_blue_hour,omitempty"`
+}
+
+type TimeWindow struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Weather alert issued by a national weather service: https://openweathermap.org/api/one-call-3
+type Alert struct {
+	SenderName  string `json:"sender_name,omitempty"`
+	Event       string `json:"event"`
+	Severity    string `json:"severity"` // minor, moderate, severe, extreme or unknown
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Description string `json:"description,omitempty"`
+	// Start and end formatted for the results page
+	StartTime   string `json:"-"`
+	EndTime     string `json:"-"`
+}
+
+// Concentrations in μg/m³
+type AirComponents struct {
+	Co   float32 `json:"co"`
+	No   float32 `json:"no"`
+	No2  float32 `json:"no2"`
+	O3   float32 `json:"o3"`
+	So2  float32 `json:"so2"`
+	Pm25 float32 `json:"pm2_5"`
+	Pm10 float32 `json:"pm10"`
+	Nh3  float32 `json:"nh3"`
 }
 
 type Main struct {
@@ -65,3 +160,141 @@ type Sys struct {
 	Sunrise int     `json:"sunrise,omitempty"`
 	Sunset  int     `json:"sunset,omitempty"`
 }
+
+// A city from the 'city' table, 'Id' is the OpenWeatherMap city id (the 'key' column)
+type City struct {
+	Id     int     `json:"id"`
+	Region string  `json:"region"`
+	Lat    float32 `json:"lat,omitempty"`
+	Lon    float32 `json:"lon,omitempty"`
+	// A "did you mean" match of a misspelled search term, see helper.CitySearch()
+	Suggestion bool `json:"suggestion,omitempty"`
+}
+
+// A city of the autocomplete served by /citylist.json, in the shape the jQuery autocomplete reads:
+// the id as 'value' and the region as 'label'
+type CityOption struct {
+	Value      int    `json:"value"`
+	Label      string `json:"label"`
+	Suggestion bool   `json:"suggestion,omitempty"`
+}
+
+// Counts of an import of OpenWeatherMap's city list into the 'city' table
+type CityImport struct {
+	Read      int
+	Added     int
+	Updated   int
+	Unchanged int
+	Skipped   int // Entries without an id or a name
+}
+
+// Result of a reverse lookup, the city closest to a coordinate
+type NearestCity struct {
+	City       City    `json:"city"`
+	DistanceKm float32 `json:"distance_km"`
+}
+
+// Error object returned by the JSON API, e.g.
+// {"error":{"code":404,"status":"not_found","message":"city not found"}}
+type ApiError struct {
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type ApiErrorResponse struct {
+	Error *ApiError `json:"error"`
+}
+
+// Five day / three hour forecast: https://openweathermap.org/forecast5
+type Forecast struct {
+	Code       string          `json:"cod"`
+	Count      int             `json:"cnt"`
+	List       []*ForecastItem `json:"list,omitempty"`
+	City       *ForecastCity   `json:"city,omitempty"`
+	Days       []*ForecastDay  `json:"days,omitempty"`
+	Units      *Units          `json:"units,omitempty"`
+	// Set when an earlier cached result is returned, as for CurrentWeather
+	Stale      bool            `json:"stale,omitempty"`
+	UserStatus string          `json:"-"`
+}
+
+type ForecastItem struct {
+	Dt      int        `json:"dt"`
+	Main    *Main      `json:"main,omitempty"`
+	Weather []*Weather `json:"weather,omitempty"`
+	Clouds  *Clouds    `json:"clouds,omitempty"`
+	Wind    *Wind      `json:"wind,omitempty"`
+	Rain    *Rain      `json:"rain,omitempty"`
+	Snow    *Snow      `json:"snow,omitempty"`
+	Pop     float32    `json:"pop"`
+	DtTxt   string     `json:"dt_txt,omitempty"`
+	Time    string     `json:"-"`
+}
+
+type ForecastCity struct {
+	Id       int    `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Coord    *Coord `json:"coord,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Timezone int    `json:"timezone"`
+	Sunrise  int    `json:"sunrise,omitempty"`
+	Sunset   int    `json:"sunset,omitempty"`
+}
+
+// Forecast items grouped by the city's local date
+type ForecastDay struct {
+	Date       string          `json:"date"`
+	TempMin    float32         `json:"temp_min"`
+	TempMax    float32         `json:"temp_max"`
+	RainVolume float32         `json:"rain,omitempty"`
+	SnowVolume float32         `json:"snow,omitempty"`
+	Weather    *Weather        `json:"weather,omitempty"`
+	Items      []*ForecastItem `json:"-"`
+}
+
+// Current weather of several cities side by side, one row per measurement and one value per city
+type Comparison struct {
+	Cities     []CurrentWeather `json:"cities"`
+	Rows       []*ComparisonRow `json:"rows"`
+	Units      *Units           `json:"units,omitempty"`
+	UserStatus string           `json:"-"`
+}
+
+type ComparisonRow struct {
+	Name   string             `json:"name"` // e.g. "temp" or "wind_speed"
+	Unit   string             `json:"unit,omitempty"`
+	Values []*ComparisonValue `json:"values"`
+}
+
+// Best and worst are only set when the row has at least two different values
+type ComparisonValue struct {
+	Value   float32 `json:"value"`
+	Missing bool    `json:"missing,omitempty"` // The city's weather could not be retrieved
+	Best    bool    `json:"best,omitempty"`
+	Worst   bool    `json:"worst,omitempty"`
+}
+
+// Units and language chosen by a user, stored in the 'users' table. Weather is always fetched in
+// metric units and converted to these on the server
+type Preferences struct {
+	Temperature string `json:"temperature"` // metric, imperial or standard
+	WindSpeed   string `json:"wind_speed"`  // ms, kmh, mph or knots
+	Pressure    string `json:"pressure"`    // hpa, inhg or mmhg
+	Language    string `json:"language"`    // Empty to follow the browser's Accept-Language
+}
+
+// Labels of the units the values are expressed in
+type Units struct {
+	Temperature string `json:"temperature"`
+	WindSpeed   string `json:"wind_speed"`
+	Pressure    string `json:"pressure"`
+}
+
+// Calls made to an upstream API on a day (UTC), and the ones the quota did not allow
+type ApiUsage struct {
+	Provider string
+	Day      string // YYYY-MM-DD
+	Calls    int
+	Rejected int
+}
@@ -0,0 +1,152 @@
+package geo
+
+import (
+	"math"
+)
+
+const (
+	EarthRadiusKm = 6371.0
+)
+
+// A location with the id it is indexed under, e.g. the OpenWeatherMap city id
+type Point struct {
+	Id  int
+	Lat float64
+	Lon float64
+}
+
+// Great-circle distance in km between two coordinates, using the haversine formula
+func Distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	phi1, phi2 := radians(lat1), radians(lat2)
+	dPhi, dLambda := radians(lat2-lat1), radians(lon2-lon1)
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func ValidCoord(lat float64, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// Spatial index answering nearest neighbour queries. Points are stored as 3D unit vectors in a
+// k-d tree; the straight-line distance between unit vectors grows with the great-circle distance,
+// so the nearest point in 3D is also the nearest on the globe, including across the poles and the
+// 180th meridian
+type Index struct {
+	nodes []indexNode
+}
+
+type indexNode struct {
+	point Point
+	xyz   [3]float64
+}
+
+// Build the index in O(n log n), the points slice is not modified
+func NewIndex(points []Point) *Index {
+	index := &Index{nodes: make([]indexNode, len(points))}
+	for i, p := range points {
+		index.nodes[i] = indexNode{point: p, xyz: toXYZ(p.Lat, p.Lon)}
+	}
+	index.build(0, len(index.nodes), 0)
+	return index
+}
+
+func (index *Index) Len() int {
+	return len(index.nodes)
+}
+
+// Find the point closest to the coordinate and its distance in km
+func (index *Index) Nearest(lat float64, lon float64) (Point, float64, bool) {
+	if len(index.nodes) == 0 {
+		return Point{}, 0, false
+	}
+
+	target := toXYZ(lat, lon)
+	best := -1
+	bestDistance := math.Inf(1)
+	index.search(0, len(index.nodes), 0, target, &best, &bestDistance)
+
+	point := index.nodes[best].point
+	return point, Distance(lat, lon, point.Lat, point.Lon), true
+}
+
+// The subtree nodes[lo:hi] has its root at the middle, split on the axis of its depth
+func (index *Index) build(lo int, hi int, axis int) {
+	if hi-lo <= 1 {
+		return
+	}
+	mid := (lo + hi) / 2
+	index.selectNth(lo, hi, mid, axis)
+	index.build(lo, mid, (axis+1)%3)
+	index.build(mid+1, hi, (axis+1)%3)
+}
+
+// Quickselect: move the node that belongs at position n (ordered by axis) there, with smaller
+// values before it and larger ones after it
+func (index *Index) selectNth(lo int, hi int, n int, axis int) {
+	nodes := index.nodes
+	for hi-lo > 1 {
+		pivot := nodes[(lo+hi)/2].xyz[axis]
+		i, j := lo, hi-1
+		for i <= j {
+			for nodes[i].xyz[axis] < pivot {
+				i++
+			}
+			for nodes[j].xyz[axis] > pivot {
+				j--
+			}
+			if i <= j {
+				nodes[i], nodes[j] = nodes[j], nodes[i]
+				i++
+				j--
+			}
+		}
+		if n <= j {
+			hi = j + 1
+		} else if n >= i {
+			lo = i
+		} else {
+			return
+		}
+	}
+}
+
+func (index *Index) search(lo int, hi int, axis int, target [3]float64, best *int, bestDistance *float64) {
+	if lo >= hi {
+		return
+	}
+	mid := (lo + hi) / 2
+	node := &index.nodes[mid]
+
+	if distance := squaredDistance(node.xyz, target); distance < *bestDistance {
+		*best, *bestDistance = mid, distance
+	}
+
+	diff := target[axis] - node.xyz[axis]
+	next := (axis + 1) % 3
+	if diff < 0 {
+		index.search(lo, mid, next, target, best, bestDistance)
+		if diff*diff < *bestDistance {
+			index.search(mid+1, hi, next, target, best, bestDistance)
+		}
+	} else {
+		index.search(mid+1, hi, next, target, best, bestDistance)
+		if diff*diff < *bestDistance {
+			index.search(lo, mid, next, target, best, bestDistance)
+		}
+	}
+}
+
+func toXYZ(lat float64, lon float64) [3]float64 {
+	phi, lambda := radians(lat), radians(lon)
+	return [3]float64{math.Cos(phi) * math.Cos(lambda), math.Cos(phi) * math.Sin(lambda), math.Sin(phi)}
+}
+
+func squaredDistance(a [3]float64, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
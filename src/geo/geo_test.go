@@ -0,0 +1,136 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Cities on both sides of the 180th meridian and near both poles, with Toronto twice under two ids
+var testPoints = []Point{
+	{1, 43.65, -79.38},   // Toronto
+	{2, 43.65, -79.38},   // Toronto again
+	{3, 51.51, -0.13},    // London
+	{4, -36.85, 174.76},  // Auckland
+	{5, -18.14, 178.44},  // Suva, Fiji
+	{6, -13.83, -171.76}, // Apia, Samoa
+	{7, 64.73, 177.51},   // Anadyr
+	{8, 71.29, -156.79},  // Utqiagvik
+	{9, 78.22, 15.65},    // Longyearbyen
+	{10, 82.50, -62.35},  // Alert
+	{11, -77.85, 166.67}, // McMurdo Station
+	{12, -90, 0},         // South Pole station
+	{13, -54.80, -68.30}, // Ushuaia
+	{14, 1.29, 103.85},   // Singapore
+	{15, 0, 0},
+}
+
+// The point closest to the coordinate by checking every one of them
+func bruteForceNearest(points []Point, lat float64, lon float64) (Point, float64) {
+	var best Point
+	bestDistance := math.Inf(1)
+	for _, p := range points {
+		if distance := Distance(lat, lon, p.Lat, p.Lon); distance < bestDistance {
+			best, bestDistance = p, distance
+		}
+	}
+	return best, bestDistance
+}
+
+func checkNearest(t *testing.T, index *Index, points []Point, lat float64, lon float64) {
+	t.Helper()
+	want, wantDistance := bruteForceNearest(points, lat, lon)
+	got, distance, found := index.Nearest(lat, lon)
+	if !found {
+		t.Fatalf("Nearest(%v, %v) found nothing", lat, lon)
+	}
+	// Points at the same distance are equally good answers
+	if math.Abs(distance-wantDistance) > 1e-6 || math.Abs(Distance(lat, lon, got.Lat, got.Lon)-distance) > 1e-6 {
+		t.Errorf("Nearest(%v, %v) = %d at %.3f km, want %d at %.3f km", lat, lon, got.Id, distance, want.Id, wantDistance)
+	}
+}
+
+func TestIndexNearest(t *testing.T) {
+	index := NewIndex(testPoints)
+
+	tests := []struct {
+		lat    float64
+		lon    float64
+		wantId int // 0 when only the distance is checked
+	}{
+		{43.70, -79.40, 0},
+		{51.50, -0.10, 3},
+		// Across the 180th meridian from either side
+		{-17.0, -179.9, 5},
+		{-17.0, 180, 5},
+		{-13.8, -174.0, 6},
+		{65.0, -179.0, 7},
+		{70.0, 180, 7},
+		{70.0, -170.0, 8},
+		// Near and at the poles, where longitudes bunch up
+		{89.9, 120, 10},
+		{90, 0, 10},
+		{-89.9, -100, 12},
+		{-90, 180, 12},
+		{-80.0, 170.0, 11},
+		{0, 0, 15},
+		{-0.5, 179.99, 0},
+	}
+
+	for _, test := range tests {
+		checkNearest(t, index, testPoints, test.lat, test.lon)
+		if got, _, _ := index.Nearest(test.lat, test.lon); test.wantId != 0 && got.Id != test.wantId {
+			t.Errorf("Nearest(%v, %v) = %d, want %d", test.lat, test.lon, got.Id, test.wantId)
+		}
+	}
+
+	// Either of the two Torontos, at no distance
+	if got, distance, _ := index.Nearest(43.65, -79.38); (got.Id != 1 && got.Id != 2) || distance > 1e-6 {
+		t.Errorf("Nearest(Toronto) = %d at %.3f km, want 1 or 2 at 0 km", got.Id, distance)
+	}
+}
+
+func TestIndexNearestRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	points := make([]Point, 500)
+	for i := range points {
+		points[i] = Point{Id: i + 1, Lat: random.Float64()*180 - 90, Lon: random.Float64()*360 - 180}
+	}
+	// Stacks of points at the same coordinate
+	for i := 0; i < 20; i++ {
+		points = append(points, Point{Id: 1000 + i, Lat: points[i%3].Lat, Lon: points[i%3].Lon})
+	}
+	index := NewIndex(points)
+	if index.Len() != len(points) {
+		t.Fatalf("Len() = %d, want %d", index.Len(), len(points))
+	}
+
+	for i := 0; i < 1000; i++ {
+		checkNearest(t, index, points, random.Float64()*180-90, random.Float64()*360-180)
+	}
+}
+
+func TestIndexEmpty(t *testing.T) {
+	for _, index := range []*Index{NewIndex(nil), NewIndex([]Point{})} {
+		if point, distance, found := index.Nearest(43.65, -79.38); found || point != (Point{}) || distance != 0 {
+			t.Errorf("Nearest() on an empty index = %+v, %v, %v", point, distance, found)
+		}
+	}
+}
+
+func TestIndexSinglePoint(t *testing.T) {
+	index := NewIndex([]Point{{7, -90, 0}})
+	if point, _, found := index.Nearest(90, 180); !found || point.Id != 7 {
+		t.Errorf("Nearest() = %+v, %v, want the only point", point, found)
+	}
+}
+
+func TestNewIndexKeepsPoints(t *testing.T) {
+	points := append([]Point(nil), testPoints...)
+	NewIndex(points)
+	for i := range points {
+		if points[i] != testPoints[i] {
+			t.Fatalf("points[%d] = %+v after NewIndex(), was %+v", i, points[i], testPoints[i])
+		}
+	}
+}
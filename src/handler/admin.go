@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"definition"
+	"helper"
+	"i18n"
+	"net/http"
+	"provider"
+	"session"
+	"settings"
+	"strings"
+)
+
+// Days of usage counters shown on the admin page
+const adminUsageDays = 30
+
+// This struct is used to render the API usage page for admins
+type AdminUsageResponse struct {
+	Quota      provider.QuotaUsage
+	Cache      provider.CacheStats
+	Usage      []definition.ApiUsage
+	UserStatus string
+}
+
+// Handle requests for "/admin/usage", which shows how much of the shared API key's quota is used
+// and how well the weather cache does. Only users listed in settings.ADMINUSERS can see it
+func AdminUsageHandler(w http.ResponseWriter, r *http.Request) {
+	var val = HtmlResponse{}
+
+	if isValidSession, _ := session.VerifySession(w, r); isValidSession {
+		val.UserStatus = "loggedin"
+		username, _ := session.ReadCookieHandler(w, r)
+
+		if !isAdmin(username) {
+			val.Result = i18n.T(language(w, r), "admin.forbidden")
+			w.WriteHeader(http.StatusForbidden)
+			t, _ := parseTemplate(w, r, "result.html")
+			t.Execute(w, val)
+			return
+		}
+
+		usage := AdminUsageResponse{
+			Quota:      apiQuota.Usage(),
+			Cache:      weatherCache.Stats(),
+			Usage:      helper.GetApiUsage(adminUsageDays),
+			UserStatus: val.UserStatus,
+		}
+		t, err := parseTemplate(w, r, "admin_usage.html")
+		checkErr("Template parsefile error", err)
+		t.Execute(w, usage)
+	} else {
+		http.Redirect(w, r, "/login", 302)
+	}
+}
+
+func isAdmin(username string) bool {
+	for _, admin := range strings.Split(settings.ADMINUSERS, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && admin == username {
+			return true
+		}
+	}
+	return false
+}
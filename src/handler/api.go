@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"definition"
+	"encoding/json"
+	"errors"
+	"helper"
+	"i18n"
+	"net/http"
+	"provider"
+	"session"
+	"strconv"
+	"strings"
+)
+
+// Versioned JSON API for scripts under "/api/v1". Every endpoint accepts the web UI's session
+// cookie or a token from "/api/v1/token" sent as "Authorization: Bearer <token>"
+
+// Exchange a username and password for a token, which is valid for as long as a web session.
+// Usage: POST /api/v1/token with 'username' and 'password' form values
+func ApiTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, "POST") {
+		return
+	}
+
+	r.ParseForm()
+	username, password := r.Form.Get("username"), r.Form.Get("password")
+	if username == "" || password == "" {
+		writeApiError(w, http.StatusBadRequest, "'username' and 'password' are required")
+		return
+	}
+	if !helper.IsValidUser(username, password, "passwordhash") {
+		writeApiError(w, http.StatusUnauthorized, "Incorrect credentials")
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]string{"token": session.CreateToken(username, password)})
+}
+
+// Current weather by city id, name, postal code or coordinates, in the user's units and language.
+// Only one of them can be given.
+// Usage: GET /api/v1/weather?id=6167865, ?city=Toronto,ca, ?zip=M5V,CA or ?lat=43.65&lon=-79.38
+func ApiWeatherHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := apiUser(w, r, "GET")
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := weatherQuery{CityID: params.Get("id"), City: params.Get("city"), Zip: params.Get("zip")}
+	hasCoord := params.Get("lat") != "" || params.Get("lon") != ""
+	selectors := 0
+	for _, given := range []bool{query.CityID != "", query.City != "", query.Zip != "", hasCoord} {
+		if given {
+			selectors++
+		}
+	}
+	if selectors > 1 {
+		writeApiError(w, http.StatusBadRequest, "Only one of 'id', 'city', 'zip' or 'lat' and 'lon' can be given")
+		return
+	}
+	if hasCoord {
+		lat, lon, valid := parseCoord(params.Get("lat"), params.Get("lon"))
+		if !valid {
+			writeApiError(w, http.StatusBadRequest, "'lat' and 'lon' must be valid coordinates")
+			return
+		}
+		query = coordQuery(lat, lon)
+	}
+	if query.CityID == "" && query.City == "" && query.Zip == "" && !query.HasCoord {
+		writeApiError(w, http.StatusBadRequest, "One of 'id', 'city', 'zip' or 'lat' and 'lon' is required")
+		return
+	}
+	if _, err := strconv.Atoi(query.CityID); query.CityID != "" && err != nil {
+		writeApiError(w, http.StatusBadRequest, "'id' must be a number")
+		return
+	}
+
+	writeApiWeather(w, r, username, query)
+}
+
+// Cities matching a search term, as used by the autocomplete.
+// Usage: GET /api/v1/cities?search=toron
+func ApiCitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := apiUser(w, r, "GET"); !ok {
+		return
+	}
+
+	search := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("search")))
+	if search == "" {
+		writeApiError(w, http.StatusBadRequest, "'search' is required")
+		return
+	}
+
+	cities := helper.CitySearch(search)
+	if cities == nil {
+		cities = []definition.City{}
+	}
+	writeJson(w, http.StatusOK, cities)
+}
+
+// The city from the 'city' table closest to a coordinate.
+// Usage: GET /api/v1/nearest?lat=43.65&lon=-79.38
+func ApiNearestHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := apiUser(w, r, "GET"); !ok {
+		return
+	}
+
+	lat, lon, valid := parseCoord(r.URL.Query().Get("lat"), r.URL.Query().Get("lon"))
+	if !valid {
+		writeApiError(w, http.StatusBadRequest, "'lat' and 'lon' must be valid coordinates")
+		return
+	}
+
+	// Without an imported city list there is nothing to look up, which is not the request's fault
+	nearest, err := helper.NearestCity(lat, lon)
+	if err != nil {
+		writeApiError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJson(w, http.StatusOK, nearest)
+}
+
+// The next "I’m feeling lucky" city of the user and its current weather. This moves the user on
+// to a new city every time, so it has to be a POST.
+// Usage: POST /api/v1/lucky
+func ApiLuckyHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := apiUser(w, r, "POST")
+	if !ok {
+		return
+	}
+
+	var query weatherQuery
+	query.CityID, query.Err = helper.GetRandomCity(username)
+	writeApiWeather(w, r, username, query)
+}
+
+// Current weather of several cities side by side, with the best and worst value of each row marked.
+// Usage: GET /api/v1/compare?id=6167865&id=2643743 or ?id=6167865,2643743
+func ApiCompareHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := apiUser(w, r, "GET")
+	if !ok {
+		return
+	}
+
+	ids, err := parseCityIDs(r.URL.Query()["id"])
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJson(w, http.StatusOK, compareCities(ids, preferencesOf(username), languageOf(username, r)))
+}
+
+func writeApiWeather(w http.ResponseWriter, r *http.Request, username string, query weatherQuery) {
+	reqWeather, err := fetchCurrentWeather(query, preferencesOf(username), languageOf(username, r))
+	if err != nil {
+		status, message := apiProviderError(err)
+		writeApiError(w, status, message)
+		return
+	}
+
+	addAirQuality(&reqWeather)
+	addAlerts(&reqWeather)
+	writeJson(w, http.StatusOK, reqWeather)
+}
+
+// Check the method and authentication of an API request. An error response has already been sent
+// when false is returned
+func apiUser(w http.ResponseWriter, r *http.Request, method string) (string, bool) {
+	if !allowMethod(w, r, method) {
+		return "", false
+	}
+
+	isValid, username := session.VerifyApiRequest(w, r)
+	if !isValid {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeApiError(w, http.StatusUnauthorized, "Please login or send a valid bearer token")
+		return "", false
+	}
+	return username, true
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeApiError(w, http.StatusMethodNotAllowed, "Use "+method)
+		return false
+	}
+	return true
+}
+
+// Unlike the HTML pages, the API tells a missing city apart from a failing upstream service
+func apiProviderError(err error) (int, string) {
+	var apiError *provider.Error
+	var ambiguous *provider.AmbiguousZipError
+	var timeout *provider.TimeoutError
+	var circuitOpen *provider.CircuitOpenError
+	if err == provider.ErrNotFound {
+		return http.StatusNotFound, "city not found"
+	} else if err == errZipNotFound {
+		return http.StatusNotFound, err.Error()
+	} else if err == helper.ErrNoCities {
+		// Like /api/v1/nearest, a missing city list is not the request's fault
+		return http.StatusServiceUnavailable, err.Error()
+	} else if errors.As(err, &apiError) && apiError.Code == http.StatusBadRequest {
+		return http.StatusBadRequest, apiError.Message
+	} else if errors.As(err, &ambiguous) {
+		return http.StatusBadRequest, ambiguousZipMessage(i18n.DefaultLanguage, ambiguous)
+	} else if err == provider.ErrQuotaExceeded {
+		return http.StatusTooManyRequests, "The weather provider's quota is used up, please try again in a minute"
+	} else if errors.As(err, &timeout) {
+		return http.StatusGatewayTimeout, "The weather provider did not answer in time, please try again later"
+	} else if errors.As(err, &circuitOpen) {
+		return http.StatusServiceUnavailable, "The weather provider is failing, please try again in a minute"
+	}
+	return http.StatusBadGateway, "The weather provider is unavailable, please try again later"
+}
+
+func writeApiError(w http.ResponseWriter, code int, message string) {
+	status := strings.ToLower(strings.Replace(http.StatusText(code), " ", "_", -1))
+	writeJson(w, code, definition.ApiErrorResponse{Error: &definition.ApiError{Code: code, Status: status, Message: message}})
+}
+
+func writeJson(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	checkErr("JSON encode error", err)
+}
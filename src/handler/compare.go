@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"definition"
+	"errors"
+	"fmt"
+	"i18n"
+	"math"
+	"net/http"
+	"session"
+	"settings"
+	"strconv"
+	"strings"
+	"sync"
+	"units"
+)
+
+var (
+	errNoCities      = errors.New("Please add at least one city")
+	errTooManyCities = fmt.Errorf("At most %d cities can be compared at once", settings.COMPAREMAXCITIES)
+)
+
+// A city id that is not a number
+type invalidCityIDError string
+
+func (e invalidCityIDError) Error() string {
+	return fmt.Sprintf("'%s' is not a city id", string(e))
+}
+
+// The rows of the comparison table. Each value is scored and the lowest score is the best, e.g.
+// the temperature closest to a comfortable 21 °C or the lightest wind
+var comparisonRows = []struct {
+	name  string
+	unit  func(labels *definition.Units) string
+	value func(reqWeather definition.CurrentWeather) (float32, bool)
+	// 'comfort' is the comfortable temperature in the user's temperature unit
+	score func(value float32, comfort float32) float64
+}{
+	{"temp", temperatureLabel, func(w definition.CurrentWeather) (float32, bool) {
+		if w.Main == nil {
+			return 0, false
+		}
+		return w.Main.Temp, true
+	}, distanceTo},
+	{"temp_min", temperatureLabel, func(w definition.CurrentWeather) (float32, bool) {
+		if w.Main == nil {
+			return 0, false
+		}
+		return w.Main.TempMin, true
+	}, distanceTo},
+	{"temp_max", temperatureLabel, func(w definition.CurrentWeather) (float32, bool) {
+		if w.Main == nil {
+			return 0, false
+		}
+		return w.Main.TempMax, true
+	}, distanceTo},
+	{"humidity", percentLabel, func(w definition.CurrentWeather) (float32, bool) {
+		if w.Main == nil {
+			return 0, false
+		}
+		return w.Main.Humidity, true
+	}, func(value float32, comfort float32) float64 {
+		// Around 45% relative humidity feels most comfortable
+		return math.Abs(float64(value) - 45)
+	}},
+	{"pressure", func(labels *definition.Units) string { return labels.Pressure }, func(w definition.CurrentWeather) (float32, bool) {
+		if w.Main == nil {
+			return 0, false
+		}
+		return w.Main.Pressure, true
+	}, func(value float32, comfort float32) float64 {
+		// High pressure comes with settled weather
+		return -float64(value)
+	}},
+	{"wind_speed", func(labels *definition.Units) string { return labels.WindSpeed }, func(w definition.CurrentWeather) (float32, bool) {
+		if w.Wind == nil {
+			return 0, false
+		}
+		return w.Wind.Speed, true
+	}, lowest},
+	{"clouds", percentLabel, func(w definition.CurrentWeather) (float32, bool) {
+		if w.Clouds == nil {
+			return 0, false
+		}
+		return w.Clouds.All, true
+	}, lowest},
+}
+
+func temperatureLabel(labels *definition.Units) string { return labels.Temperature }
+
+func percentLabel(labels *definition.Units) string { return "%" }
+
+func distanceTo(value float32, comfort float32) float64 {
+	return math.Abs(float64(value - comfort))
+}
+
+func lowest(value float32, comfort float32) float64 {
+	return float64(value)
+}
+
+// Handle requests for the side-by-side comparison of several cities, e.g. "/compare?id=1&id=2" or
+// "/compare?id=1,2". Without any city the form to pick them is shown
+func CompareHandler(w http.ResponseWriter, r *http.Request) {
+	var val = HtmlResponse{}
+
+	if isValidSession, _ := session.VerifySession(w, r); isValidSession {
+		val.UserStatus = "loggedin"
+		r.ParseForm()
+		lang := language(w, r)
+
+		comparison := definition.Comparison{UserStatus: val.UserStatus}
+		if len(r.Form["id"]) > 0 {
+			ids, err := parseCityIDs(r.Form["id"])
+			if err != nil {
+				val.Result = compareErrorMessage(lang, err)
+				t, _ := parseTemplate(w, r, "result.html")
+				t.Execute(w, val)
+				return
+			}
+			comparison = compareCities(ids, userPreferences(w, r), lang)
+			comparison.UserStatus = val.UserStatus
+		}
+
+		t, err := parseTemplate(w, r, "compare.html")
+		checkErr("Template parsefile error", err)
+		t.Execute(w, comparison)
+	} else {
+		http.Redirect(w, r, "/login", 302)
+	}
+}
+
+// City ids may be repeated or separated by commas. Duplicates are dropped, keeping the order the
+// cities were picked in
+func parseCityIDs(values []string) ([]string, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, id := range strings.Split(value, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" || seen[id] {
+				continue
+			}
+			if _, err := strconv.Atoi(id); err != nil {
+				return nil, invalidCityIDError(id)
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, errNoCities
+	} else if len(ids) > settings.COMPAREMAXCITIES {
+		return nil, errTooManyCities
+	}
+	return ids, nil
+}
+
+func compareErrorMessage(lang string, err error) string {
+	if id, isInvalid := err.(invalidCityIDError); isInvalid {
+		return fmt.Sprintf(i18n.T(lang, "compare.invalid_id"), string(id))
+	} else if err == errTooManyCities {
+		return fmt.Sprintf(i18n.T(lang, "compare.too_many"), settings.COMPAREMAXCITIES)
+	}
+	return i18n.T(lang, "compare.err_cities")
+}
+
+// The cities are fetched concurrently by a fixed number of workers, so a long list does not open
+// a connection per city. A city whose weather could not be retrieved keeps its id and error in
+// 'Code' and 'Message' and is left out of the best and worst values
+func compareCities(ids []string, prefs definition.Preferences, lang string) definition.Comparison {
+	cities := make([]definition.CurrentWeather, len(ids))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for n := 0; n < settings.COMPAREWORKERS && n < len(ids); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				cities[i] = getCurrentWeather(weatherQuery{CityID: ids[i]}, prefs, lang)
+				if cities[i].CityId == 0 {
+					cities[i].CityId, _ = strconv.Atoi(ids[i])
+				}
+			}
+		}()
+	}
+	for i := range ids {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	labels := units.Labels(prefs)
+	comfort := units.Temperature(21, prefs.Temperature)
+	comparison := definition.Comparison{Cities: cities, Units: labels}
+
+	for _, rule := range comparisonRows {
+		row := &definition.ComparisonRow{Name: rule.name, Unit: rule.unit(labels)}
+		best, worst := -1, -1
+		for i, reqWeather := range cities {
+			value, found := rule.value(reqWeather)
+			if reqWeather.Code != 200 || !found {
+				row.Values = append(row.Values, &definition.ComparisonValue{Missing: true})
+				continue
+			}
+			row.Values = append(row.Values, &definition.ComparisonValue{Value: value})
+
+			score := rule.score(value, comfort)
+			if best < 0 || score < rule.score(row.Values[best].Value, comfort) {
+				best = i
+			}
+			if worst < 0 || score > rule.score(row.Values[worst].Value, comfort) {
+				worst = i
+			}
+		}
+
+		// Nothing stands out when every city has the same score
+		if best >= 0 && rule.score(row.Values[best].Value, comfort) != rule.score(row.Values[worst].Value, comfort) {
+			row.Values[best].Best = true
+			row.Values[worst].Worst = true
+		}
+		comparison.Rows = append(comparison.Rows, row)
+	}
+
+	return comparison
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"definition"
+	"encoding/json"
+	"net/http"
+	"provider"
+	"session"
+	"strconv"
+	"time"
+	"units"
+)
+
+// Handle requests for the five day forecast page. It accepts the same city id, free-text and
+// "I’m feeling lucky" inputs as SearchHandler, either posted from the search form or in the URL
+func ForecastHandler(w http.ResponseWriter, r *http.Request) {
+	var val = HtmlResponse{}
+
+	if isValidSession, _ := session.VerifySession(w, r); isValidSession {
+		val.UserStatus = "loggedin"
+		r.ParseForm()
+
+		if r.Method == "GET" && !hasWeatherQuery(r) {
+			// The search form is reused, posting to this handler instead
+			val.Action = "/forecast"
+			t, _ := parseTemplate(w, r, "search.html")
+			t.Execute(w, val)
+			return
+		}
+
+		lang := language(w, r)
+		forecast, code, message := getForecast(parseWeatherQuery(w, r), userPreferences(w, r), lang)
+		if code != 0 {
+			val.Result = searchErrorMessage(lang, code, message)
+			t, _ := parseTemplate(w, r, "result.html")
+			t.Execute(w, val)
+		} else {
+			forecast.UserStatus = val.UserStatus
+			t, err := parseTemplate(w, r, "forecast.html")
+			checkErr("Template parsefile error", err)
+			t.Execute(w, forecast)
+		}
+	} else {
+		http.Redirect(w, r, "/login", 302)
+	}
+}
+
+// JSON version of ForecastHandler, e.g. "/forecast.json?city=London". Errors are returned in the
+// same shape as OpenWeatherMap uses: {"cod":"404","message":"city not found"}
+func ForecastJsonHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if isValidSession, _ := session.VerifySession(w, r); !isValidSession {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"cod": "401", "message": "Please login"})
+		return
+	}
+
+	r.ParseForm()
+	forecast, code, message := getForecast(parseWeatherQuery(w, r), userPreferences(w, r), language(w, r))
+	if code != 0 {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"cod": strconv.Itoa(code), "message": message})
+		return
+	}
+
+	json.NewEncoder(w).Encode(forecast)
+}
+
+// Retrieve the forecast from the forecast provider in the user's preferred units and language, and
+// group it by day. A non-zero code is returned along with the message when the lookup failed
+func getForecast(query weatherQuery, prefs definition.Preferences, lang string) (definition.Forecast, int, string) {
+	opts := provider.Options{Units: "metric", Lang: lang}
+
+	var forecast definition.Forecast
+	var err error
+	if query.Err != nil {
+		err = query.Err
+	} else if query.CityID != "" {
+		forecast, err = forecastProvider.ForecastByCityID(query.CityID, opts)
+	} else if query.Zip != "" {
+		var zip, country string
+		if zip, country, err = provider.ParseZip(query.Zip); err == nil {
+			forecast, err = forecastProvider.ForecastByZip(zip, country, opts)
+		}
+		err = zipError(err)
+	} else if query.HasCoord {
+		forecast, err = forecastProvider.ForecastByCoord(float32(query.Lat), float32(query.Lon), opts)
+	} else {
+		forecast, err = forecastProvider.ForecastByName(query.City, opts)
+	}
+
+	if err != nil {
+		checkErr("Forecast provider error", err)
+		code, message := providerError(lang, err)
+		return forecast, code, message
+	}
+
+	units.ConvertForecast(&forecast, prefs)
+	groupForecastDays(&forecast)
+	return forecast, 0, ""
+}
+
+// The forecast items are grouped by the city's local date. For each day the temperature range
+// and precipitation totals are worked out, and the weather closest to midday is used as a summary
+func groupForecastDays(forecast *definition.Forecast) {
+	offset := 0
+	if forecast.City != nil {
+		offset = forecast.City.Timezone
+	}
+	zone := time.FixedZone("", offset)
+
+	var day *definition.ForecastDay
+	closestToNoon := 0
+
+	for _, item := range forecast.List {
+		local := time.Unix(int64(item.Dt), 0).In(zone)
+		item.Time = local.Format("15:04")
+
+		date := local.Format("Mon, Jan 2")
+		if day == nil || day.Date != date {
+			day = &definition.ForecastDay{Date: date}
+			closestToNoon = 24
+			forecast.Days = append(forecast.Days, day)
+		}
+
+		if item.Main != nil {
+			if len(day.Items) == 0 || item.Main.TempMin < day.TempMin {
+				day.TempMin = item.Main.TempMin
+			}
+			if len(day.Items) == 0 || item.Main.TempMax > day.TempMax {
+				day.TempMax = item.Main.TempMax
+			}
+		}
+		if item.Rain != nil {
+			day.RainVolume += item.Rain.RainVolume3H
+		}
+		if item.Snow != nil {
+			day.SnowVolume += item.Snow.SnowVolume3H
+		}
+
+		fromNoon := local.Hour() - 12
+		if fromNoon < 0 {
+			fromNoon = -fromNoon
+		}
+		if len(item.Weather) > 0 && fromNoon < closestToNoon {
+			day.Weather = item.Weather[0]
+			closestToNoon = fromNoon
+		}
+
+		day.Items = append(day.Items, item)
+	}
+}
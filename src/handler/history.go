@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"chart"
+	"definition"
+	"helper"
+	"html/template"
+	"i18n"
+	"net/http"
+	"session"
+	"strconv"
+	"strings"
+	"time"
+	"units"
+)
+
+// The time windows that can be picked on the history page, the first one is the default
+var historyWindows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+	{"1y", 365 * 24 * time.Hour},
+}
+
+// This struct is used to render the history page
+type HistoryResponse struct {
+	CityId       int
+	Region       string
+	Window       string
+	Windows      []string
+	Observations int
+	Charts       []template.HTML
+	UserStatus   string
+}
+
+// Handle requests for the observation history of a city, e.g. "/history/6167865?window=7d". The
+// charts are rendered as SVG on the server, so the page needs no scripts or CDN
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	var val = HtmlResponse{}
+
+	if isValidSession, _ := session.VerifySession(w, r); isValidSession {
+		val.UserStatus = "loggedin"
+		lang := language(w, r)
+
+		cityId, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/history/"))
+		if err != nil || cityId <= 0 {
+			val.Result = i18n.T(lang, "history.invalid_city")
+			t, _ := parseTemplate(w, r, "result.html")
+			t.Execute(w, val)
+			return
+		}
+
+		history := getHistory(cityId, r.URL.Query().Get("window"), userPreferences(w, r), lang, time.Now())
+		history.UserStatus = val.UserStatus
+		t, err := parseTemplate(w, r, "history.html")
+		checkErr("Template parsefile error", err)
+		t.Execute(w, history)
+	} else {
+		http.Redirect(w, r, "/login", 302)
+	}
+}
+
+// The stored observations of the window are converted to the user's units and charted
+func getHistory(cityId int, window string, prefs definition.Preferences, lang string, now time.Time) HistoryResponse {
+	history := HistoryResponse{CityId: cityId, Window: historyWindows[0].Name}
+	duration := historyWindows[0].Duration
+	for _, historyWindow := range historyWindows {
+		history.Windows = append(history.Windows, historyWindow.Name)
+		if historyWindow.Name == window {
+			history.Window, duration = historyWindow.Name, historyWindow.Duration
+		}
+	}
+
+	from, to := now.Add(-duration).Unix(), now.Unix()
+	observations := helper.GetObservations(cityId, from, to)
+	history.Observations = len(observations)
+
+	var temperature, humidity, pressure []chart.Point
+	var timezone int
+	for _, reqWeather := range observations {
+		units.ConvertWeather(&reqWeather, prefs)
+		at := int64(reqWeather.Dt)
+		temperature = append(temperature, chart.Point{Time: at, Value: float64(reqWeather.Main.Temp)})
+		humidity = append(humidity, chart.Point{Time: at, Value: float64(reqWeather.Main.Humidity)})
+		pressure = append(pressure, chart.Point{Time: at, Value: float64(reqWeather.Main.Pressure)})
+		history.Region = reqWeather.Name + ", " + reqWeather.Sys.Country
+		// The city's current offset, which changes with daylight saving time
+		timezone = reqWeather.Timezone
+	}
+	if history.Region == "" {
+		history.Region = helper.GetCityRegion(strconv.Itoa(cityId))
+	}
+
+	labels := units.Labels(prefs)
+	emptyText := i18n.T(lang, "history.no_observations")
+	for _, lineChart := range []chart.LineChart{
+		{Title: i18n.T(lang, "history.temperature"), Unit: labels.Temperature, Color: "#d9534f", Points: temperature},
+		{Title: i18n.T(lang, "history.humidity"), Unit: "%", Color: "#5bc0de", Points: humidity},
+		{Title: i18n.T(lang, "history.pressure"), Unit: labels.Pressure, Color: "#5cb85c", Points: pressure},
+	} {
+		lineChart.From, lineChart.To, lineChart.Timezone, lineChart.EmptyText = from, to, timezone, emptyText
+		// SVG() escapes all text it puts in the chart
+		history.Charts = append(history.Charts, template.HTML(lineChart.SVG()))
+	}
+
+	return history
+}
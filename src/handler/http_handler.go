@@ -3,26 +3,113 @@
 package handler
 
 import (
-	"encoding/json"
+	"astro"
+	"comfort"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"html/template"
-	"time"
 	"log"
+	"math"
+	"path/filepath"
 	"definition"
+	"provider"
 	"settings"
+	"geo"
 	"helper"
+	"i18n"
 	"session"
+	"strconv"
 	"strings"
+	"time"
+	"units"
+)
+
+// Name the OpenWeatherMap calls are counted under in the 'apiUsage' table
+const openWeatherMapUsage = "OpenWeatherMap"
+
+// Bounds of the 'limit' and 'offset' parameters of /citylist.json
+const (
+	maxCityLimit  = 50
+	maxCityOffset = 1000
 )
 
+var (
+	openWeatherMap = provider.NewOpenWeatherMap(settings.APIKEY)
+	// All users share one API key, so its calls are governed. Calls made earlier today count too, see
+	// LoadApiUsage()
+	apiQuota = provider.NewQuota(settings.APIQUOTAPERMINUTE, settings.APIQUOTAPERDAY, 0)
+	// Open-Meteo is only asked when OpenWeatherMap fails or its quota is used up. Answers from either
+	// are cached, and when both fail an expired answer is shown. Forecasts and air quality are cached
+	// the same way
+	weatherCache = provider.NewCache(provider.NewChain(openWeatherMap, provider.NewOpenMeteo(helper.GetCityRegion)),
+		settings.WEATHERCACHETTLMINUTES*time.Minute, settings.WEATHERSTALEMAXHOURS*time.Hour)
+	weatherProvider provider.WeatherProvider = weatherCache
+	forecastProvider provider.ForecastProvider = weatherCache.Forecasts(openWeatherMap)
+	airQualityProvider provider.AirQualityProvider = weatherCache.AirQuality(openWeatherMap)
+	alertProvider provider.AlertProvider = openWeatherMap
+)
+
+// Templates are read from this directory, relative to the server directory like the message catalogs
+var TemplateDir = "templates"
+
+func init() {
+	apiQuota.OnUse(func(allowed bool) {
+		helper.RecordApiUsage(openWeatherMapUsage, allowed)
+	})
+	openWeatherMap.SetQuota(apiQuota)
+}
+
+// Take the OpenWeatherMap calls recorded today off the quota, e.g. the ones made before a restart.
+// The database has to be open
+func LoadApiUsage() {
+	apiQuota.SetUsedToday(helper.GetApiCallsToday(openWeatherMapUsage))
+}
+
 // This struct is used to interact with the HTML while rendering 
 type HtmlResponse struct{
 	Result string
 	Action string
 	Username string
 	UserStatus string
+	Preferences definition.Preferences
+}
+
+// A coordinate search is answered with the nearest known city, unless it is further than this
+const nearestCityMaxKm = 50
+
+// Postal code lookups say so when nothing is found, "city not found" would be confusing
+var errZipNotFound = errors.New("postal code not found")
+
+// What the user searched for, either a city id from the 'city' table, a postal code, a coordinate
+// or a free-text city name
+type weatherQuery struct {
+	CityID string
+	City string
+	// Postal code as typed by the user, optionally with its country as in "M5V, CA"
+	Zip string
+	Lat float64
+	Lon float64
+	HasCoord bool
+	// Set when the query cannot be made, e.g. "I’m feeling lucky" before any city was imported
+	Err error
+}
+
+// Replace the provider used by the handlers, e.g. with a different weather service or a fake one
+func SetWeatherProvider(p provider.WeatherProvider) {
+	weatherProvider = p
+}
+
+func SetForecastProvider(p provider.ForecastProvider) {
+	forecastProvider = p
+}
+
+func SetAirQualityProvider(p provider.AirQualityProvider) {
+	airQualityProvider = p
+}
+
+func SetAlertProvider(p provider.AlertProvider) {
+	alertProvider = p
 }
 
 func RootHandler(w http.ResponseWriter, r *http.Request) {
@@ -31,7 +118,7 @@ func RootHandler(w http.ResponseWriter, r *http.Request) {
 		val.UserStatus = "loggedin" // To show the log in or log out icon in the HTML
 	}
 
-	t, _ := template.ParseFiles("templates/hello.html")
+	t, _ := parseTemplate(w, r, "hello.html")
 	t.Execute(w, val)
 }
 
@@ -41,14 +128,42 @@ func HelloHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // This handler will respond based on the city search query with an array of JSON as result
-// The jQuery autocomplete plugin uses the result to show suggestions within the search box
+// The jQuery autocomplete plugin uses the result to show suggestions within the search box.
+// Without a search term the array is empty.
+// Usage: /citylist.json?search=toron&limit=5&offset=0&country=CA
 func CityHandler(w http.ResponseWriter, r *http.Request) {
-	searchQuery := r.URL.Query().Get("search")
-	if len(searchQuery) > 0 {
-		output := helper.CityQuery(strings.ToLower(searchQuery))
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte("["+strings.TrimSuffix(output, ",")+"]"))
+	query := r.URL.Query()
+
+	limit, validLimit := intParam(query.Get("limit"), 5, 1, maxCityLimit)
+	if !validLimit {
+		writeApiError(w, http.StatusBadRequest, fmt.Sprintf("'limit' must be a number from 1 to %d", maxCityLimit))
+		return
+	}
+	offset, validOffset := intParam(query.Get("offset"), 0, 0, maxCityOffset)
+	if !validOffset {
+		writeApiError(w, http.StatusBadRequest, fmt.Sprintf("'offset' must be a number from 0 to %d", maxCityOffset))
+		return
 	}
+
+	options := []definition.CityOption{}
+	if searchQuery := strings.TrimSpace(query.Get("search")); searchQuery != "" {
+		found := helper.CityQuery(strings.ToLower(searchQuery), query.Get("country"), limit, offset)
+		options = append(options, found...)
+	}
+	writeJson(w, http.StatusOK, options)
+}
+
+// An optional integer query parameter, 'fallback' when it is empty. It is not valid when it is not
+// a number from 'min' to 'max'
+func intParam(value string, fallback int, min int, max int) (int, bool) {
+	if value == "" {
+		return fallback, true
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < min || number > max {
+		return 0, false
+	}
+	return number, true
 }
 
 // Handle requests to display weather data based on the cities searched by the user or random 
@@ -60,43 +175,27 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 	if isValidSession, _ := session.VerifySession(w, r); isValidSession {
 		val.UserStatus = "loggedin"
 		if r.Method == "GET" {
-			t, _ := template.ParseFiles("templates/search.html")
+			t, _ := parseTemplate(w, r, "search.html")
 			t.Execute(w, val)
 		} else if r.Method == "POST" {
 			r.ParseForm()
 
-			var luckyCityId string
-
-			if r.Form["type"][0] == "feelinglucky" {
-				username, _ := session.ReadCookieHandler(w, r)
-				// Retrieves random unique cities by utilizing double hashing function to resolve collisions
-				luckyCityId = helper.GetRandomCity(username)
-			}
-
-			// Depending on whether the user wants to search by using the autocompleted city, custom city search
-			// or I'm Feeling Lucky feature the appropriate request is made to OpenWeatherMap API
-			var query string
-			if luckyCityId != "" {
-				query = fmt.Sprintf("http://api.openweathermap.org/data/2.5/weather?id=%s&type=accurate&units=metric&mode=json&APPID=%s", luckyCityId, settings.APIKEY)
-			} else if r.Form["cityautocomplete"][0] != "" {
-				query = fmt.Sprintf("http://api.openweathermap.org/data/2.5/weather?id=%s&type=accurate&units=metric&mode=json&APPID=%s", r.Form["cityautocomplete"][0], settings.APIKEY)
-			} else {
-				query = fmt.Sprintf("http://api.openweathermap.org/data/2.5/weather?q=%s&type=accurate&units=metric&mode=json&APPID=%s", r.Form["city"][0], settings.APIKEY)
-			}
-
-			apiResult := getCurrentWeather(query)
+			lang := language(w, r)
+			apiResult := getCurrentWeather(parseWeatherQuery(w, r), userPreferences(w, r), lang)
+			addAirQuality(&apiResult)
+			addAlerts(&apiResult)
 			
 			apiResult.UserStatus = val.UserStatus
 
 			// If there is an error code resulted based on the query then the appropriate message is displayed
-			if apiResult.Code == 400 || apiResult.Code == 404 {
+			if apiResult.Code != 200 {
 				var val = HtmlResponse{}
 		
-				val.Result = fmt.Sprintf("Please try again. Error message: '%s'", apiResult.Message)
-				t, _ := template.ParseFiles("templates/result.html")
+				val.Result = searchErrorMessage(lang, apiResult.Code, apiResult.Message)
+				t, _ := parseTemplate(w, r, "result.html")
 				t.Execute(w, val)
 			} else {
-				t, _ := template.ParseFiles("templates/weather_results.html")
+				t, _ := parseTemplate(w, r, "weather_results.html")
 				t.Execute(w, apiResult)
 			}
 		}
@@ -112,20 +211,21 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	if isValidSession, _ := session.VerifySession(w, r); isValidSession {
 		val.UserStatus = "loggedin"
 	}
+	lang := language(w, r)
 	if r.Method == "GET" {
-		t, _ := template.ParseFiles("templates/create_user.html")
+		t, _ := parseTemplate(w, r, "create_user.html")
 		t.Execute(w, val)
 	} else if r.Method == "POST" {
 		r.ParseForm()
 		if helper.CheckUsernameExists(r.Form["username"][0]) {
-			val.Result = fmt.Sprintf("The username: '%s' is already registered, please try again.", r.Form["username"][0])
-			t, _ := template.ParseFiles("templates/result.html")
+			val.Result = fmt.Sprintf(i18n.T(lang, "create.username_taken"), r.Form["username"][0])
+			t, _ := parseTemplate(w, r, "result.html")
 			t.Execute(w, val)
 		} else {
 			helper.CreateUser(r.Form["username"][0], r.Form["password"][0], r.Form["fullname"][0], r.Form["question"][0], r.Form["answer"][0])
 			
-			val.Result = "User created successfully!"
-			t, _ := template.ParseFiles("templates/result.html")
+			val.Result = i18n.T(lang, "create.done")
+			t, _ := parseTemplate(w, r, "result.html")
 			t.Execute(w, val)
 		}
 	}
@@ -135,17 +235,20 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var val = HtmlResponse{}
 	isValidSession, message := session.VerifySession(w, r)
+	lang := language(w, r)
 
 	// Users who have a valid session is not allow to log in again
 	if isValidSession {
 		val.UserStatus = "loggedin"
-		val.Result = "Already logged in"
-		t, _ := template.ParseFiles("templates/result.html")
+		val.Result = i18n.T(lang, "login.already_logged_in")
+		t, _ := parseTemplate(w, r, "result.html")
 		t.Execute(w, val)
 	} else {
 		if r.Method == "GET" {
-			val.Result = message
-			t, _ := template.ParseFiles("templates/login.html")
+			if message != "" {
+				val.Result = i18n.T(lang, "login.session_expired")
+			}
+			t, _ := parseTemplate(w, r, "login.html")
 			t.Execute(w, val)
 		} else if r.Method == "POST" {
 			r.ParseForm()
@@ -153,12 +256,12 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 			if helper.IsValidUser(r.Form["username"][0], r.Form["password"][0], "passwordhash") {
 				val.UserStatus = "loggedin"
 				session.SetSession(w, r, r.Form["username"][0], r.Form["password"][0])
-				val.Result = fmt.Sprintf("Hello %s!\n", r.Form["username"][0])
-				t, _ := template.ParseFiles("templates/result.html")
+				val.Result = fmt.Sprintf(i18n.T(lang, "login.hello"), r.Form["username"][0])
+				t, _ := parseTemplate(w, r, "result.html")
 				t.Execute(w, val)
 			} else{
-				val.Result = "Incorrect credentials!"
-				t, _ := template.ParseFiles("templates/login.html")
+				val.Result = i18n.T(lang, "login.incorrect")
+				t, _ := parseTemplate(w, r, "login.html")
 				t.Execute(w, val)
 			}
 		}
@@ -171,12 +274,12 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	var val = HtmlResponse{}
 	if isValidSession, _ := session.VerifySession(w, r); isValidSession {
 		session.ClearSession(w, r)
-		val.Result = "Logged out successfully!"
-		t, _ := template.ParseFiles("templates/result.html")
+		val.Result = i18n.T(language(w, r), "logout.done")
+		t, _ := parseTemplate(w, r, "result.html")
 		t.Execute(w, val)
 	} else {
-		val.Result = "Not logged in"
-		t, _ := template.ParseFiles("templates/result.html")
+		val.Result = i18n.T(language(w, r), "logout.not_logged_in")
+		t, _ := parseTemplate(w, r, "result.html")
 		t.Execute(w, val)
 	}
 }
@@ -186,14 +289,14 @@ func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
 	var val = HtmlResponse{}
 	if isValidSession, _ := session.VerifySession(w, r); isValidSession {
 		val.UserStatus = "loggedin"
-		val.Result = "Already logged in, please log out to reset password."
-		t, _ := template.ParseFiles("templates/result.html")
+		val.Result = i18n.T(language(w, r), "reset.already_logged_in")
+		t, _ := parseTemplate(w, r, "result.html")
 		t.Execute(w, val)
 	} else {
 		if r.Method == "GET" {
 			// The user is asked for their username first
 			val.Action = "username"
-			t, err := template.ParseFiles("templates/password_reset.html")
+			t, err := parseTemplate(w, r, "password_reset.html")
 			checkErr("Template parsefile error", err)
 			t.Execute(w, val)
 		} else if r.Method == "POST" {
@@ -201,8 +304,8 @@ func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
 			if r.Form["result"][0] == "usernamesubmitted" {
 				if !helper.CheckUsernameExists(r.Form["val"][0]) {
 					val.Action = "message"
-					val.Result = fmt.Sprintf("The username: '%s' is not registered", r.Form["val"][0])
-					t, err := template.ParseFiles("templates/password_reset.html")
+					val.Result = fmt.Sprintf(i18n.T(language(w, r), "reset.not_registered"), r.Form["val"][0])
+					t, err := parseTemplate(w, r, "password_reset.html")
 					checkErr("Template parsefile error", err)
 					t.Execute(w, val)
 				} else {
@@ -210,7 +313,7 @@ func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
 					val.Action = "question"
 					val.Result = helper.GetSecretQuestion(r.Form["val"][0])
 					val.Username = r.Form["val"][0]
-					t, err := template.ParseFiles("templates/password_reset.html")
+					t, err := parseTemplate(w, r, "password_reset.html")
 					checkErr("Template parsefile error", err)
 					t.Execute(w, val)
 				}
@@ -219,13 +322,13 @@ func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
 					// Once the answer to secret question is validated, the user can enter the new password
 					val.Action = "resetpass"
 					val.Username = r.Form["username"][0]
-					t, err := template.ParseFiles("templates/password_reset.html")
+					t, err := parseTemplate(w, r, "password_reset.html")
 					checkErr("Template parsefile error", err)
 					t.Execute(w, val)
 				} else {
 					val.Action = "message"
-					val.Result = "The answer to the secret question is incorrect."
-					t, err := template.ParseFiles("templates/password_reset.html")
+					val.Result = i18n.T(language(w, r), "reset.wrong_answer")
+					t, err := parseTemplate(w, r, "password_reset.html")
 					checkErr("Template parsefile error", err)
 					t.Execute(w, val)
 				}
@@ -233,8 +336,8 @@ func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
 				// The 'users' table is updated with the new password hash
 				helper.ResetPassword(r.Form["username"][0], r.Form["password"][0])
 				val.Action = "message"
-				val.Result = "Password is reset!"
-				t, err := template.ParseFiles("templates/password_reset.html")
+				val.Result = i18n.T(language(w, r), "reset.done")
+				t, err := parseTemplate(w, r, "password_reset.html")
 				checkErr("Template parsefile error", err)
 				t.Execute(w, val)
 			}
@@ -242,27 +345,373 @@ func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// The OpenWeatherMap API is sent with the request with user's query
-// and the JSON result is decoded into the 'CurrentWeather' stuct
-func getCurrentWeather(apiUrl string) definition.CurrentWeather {
-	var apiClient = &http.Client{Timeout: 10 * time.Second}
-	response, err := apiClient.Get(apiUrl)
-	checkErr("HTTP Get error", err)
+// Depending on whether the user wants to search by using the autocompleted city, a postal code,
+// their location, custom city search or I'm Feeling Lucky feature the matching lookup is made
+func parseWeatherQuery(w http.ResponseWriter, r *http.Request) weatherQuery {
+	var query weatherQuery
 
-	body, err := ioutil.ReadAll(response.Body)
-	response.Body.Close()
+	if r.Form.Get("type") == "feelinglucky" {
+		username, _ := session.ReadCookieHandler(w, r)
+		// Retrieves random unique cities by utilizing double hashing function to resolve collisions
+		query.CityID, query.Err = helper.GetRandomCity(username)
+	} else if r.Form.Get("cityautocomplete") != "" {
+		query.CityID = r.Form.Get("cityautocomplete")
+	} else if r.Form.Get("zip") != "" {
+		query.Zip = r.Form.Get("zip")
+	} else if lat, lon, ok := parseCoord(r.Form.Get("lat"), r.Form.Get("lon")); ok {
+		query = coordQuery(lat, lon)
+	} else {
+		query.City = r.Form.Get("city")
+	}
+
+	return query
+}
+
+// Coordinates are resolved to the nearest city from the 'city' table, so the results are named
+// after a known city. Far from any city, or when no city has coordinates yet, the provider is asked
+// for the coordinate itself
+func coordQuery(lat float64, lon float64) weatherQuery {
+	query := weatherQuery{Lat: lat, Lon: lon, HasCoord: true}
+	nearest, err := helper.NearestCity(lat, lon)
+	if err == nil && nearest.DistanceKm <= nearestCityMaxKm {
+		query.CityID = strconv.Itoa(nearest.City.Id)
+	}
+	return query
+}
+
+func parseCoord(latValue string, lonValue string) (float64, float64, bool) {
+	lat, errLat := strconv.ParseFloat(latValue, 64)
+	lon, errLon := strconv.ParseFloat(lonValue, 64)
+	if errLat != nil || errLon != nil || !geo.ValidCoord(lat, lon) {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// Check whether the request carries any of the inputs accepted by parseWeatherQuery()
+func hasWeatherQuery(r *http.Request) bool {
+	return r.Form.Get("type") == "feelinglucky" || r.Form.Get("cityautocomplete") != "" || r.Form.Get("city") != "" ||
+		r.Form.Get("zip") != "" || r.Form.Get("lat") != ""
+}
 
-	var reqWeather = definition.CurrentWeather{}
-	err = json.Unmarshal(body, &reqWeather)
-	
+// The weather provider is sent the request with user's query and the result is returned as
+// a 'CurrentWeather' struct in the user's preferred units and language. Provider errors are
+// reported through 'Code' and 'Message'
+func getCurrentWeather(query weatherQuery, prefs definition.Preferences, lang string) definition.CurrentWeather {
+	reqWeather, err := fetchCurrentWeather(query, prefs, lang)
 	if err != nil {
-		// Query not found in the OpenWeatherMap API
-		reqWeather.Code = 404
+		reqWeather = definition.CurrentWeather{}
+		reqWeather.Code, reqWeather.Message = providerError(lang, err)
 	}
 
 	return reqWeather
 }
 
+// Same as getCurrentWeather() but the provider error is returned as is, for the JSON API
+func fetchCurrentWeather(query weatherQuery, prefs definition.Preferences, lang string) (definition.CurrentWeather, error) {
+	opts := provider.Options{Units: "metric", Lang: lang}
+
+	var reqWeather definition.CurrentWeather
+	var err error
+	if query.Err != nil {
+		err = query.Err
+	} else if query.CityID != "" {
+		reqWeather, err = weatherProvider.ByCityID(query.CityID, opts)
+	} else if query.Zip != "" {
+		var zip, country string
+		if zip, country, err = provider.ParseZip(query.Zip); err == nil {
+			reqWeather, err = weatherProvider.ByZip(zip, country, opts)
+		}
+		err = zipError(err)
+	} else if query.HasCoord {
+		reqWeather, err = weatherProvider.ByCoord(float32(query.Lat), float32(query.Lon), opts)
+	} else {
+		reqWeather, err = weatherProvider.ByName(query.City, opts)
+	}
+
+	if err != nil {
+		checkErr("Weather provider error", err)
+		return reqWeather, err
+	}
+
+	translateConditions(reqWeather.Weather, lang)
+	// Kept for the city's history, before it is converted to the user's units
+	helper.SaveObservation(reqWeather)
+	reqWeather.Comfort = comfort.Metrics(reqWeather.Main, reqWeather.Wind)
+	reqWeather.Daylight = daylightOf(reqWeather)
+	reqWeather.Astronomy = astronomyOf(reqWeather)
+	units.ConvertWeather(&reqWeather, prefs)
+	return reqWeather, nil
+}
+
+// OpenWeatherMap describes the weather in the language asked for, the providers that only report a
+// code leave its description to be translated here
+func translateConditions(conditions []*definition.Weather, lang string) {
+	for _, weather := range conditions {
+		if weather.DescriptionKey != "" {
+			weather.Description = i18n.T(lang, "condition."+weather.DescriptionKey)
+		}
+	}
+}
+
+// The air quality is looked up by the coordinates of a weather result. It is an extra, so when the
+// lookup fails the result is shown without it
+func addAirQuality(reqWeather *definition.CurrentWeather) {
+	if reqWeather.Code != 200 || reqWeather.Coord == nil || airQualityProvider == nil {
+		return
+	}
+
+	airQuality, err := airQualityProvider.AirQuality(reqWeather.Coord.Lat, reqWeather.Coord.Lon)
+	if err != nil {
+		checkErr("Air quality provider error", err)
+		return
+	}
+	reqWeather.AirQuality = &airQuality
+}
+
+// Weather alerts for a weather result. They are stored per location and only fetched again once
+// the stored ones are out of date. Alerts that have already ended are left out
+func addAlerts(reqWeather *definition.CurrentWeather) {
+	if reqWeather.Code != 200 || reqWeather.Coord == nil || alertProvider == nil {
+		return
+	}
+
+	location := alertLocation(*reqWeather)
+	alerts, found := helper.GetStoredAlerts(location)
+	if !found {
+		var err error
+		alerts, err = alertProvider.Alerts(reqWeather.Coord.Lat, reqWeather.Coord.Lon)
+		if err != nil {
+			checkErr("Alert provider error", err)
+			helper.DeferAlertCheck(location, alertsRetryAt(err, time.Now()))
+			return
+		}
+		helper.StoreAlerts(location, alerts, alertsValidUntil(alerts, time.Now()))
+	}
+
+	// Shown in the city's local time
+	zone := time.FixedZone("", reqWeather.Timezone)
+	now := time.Now().Unix()
+	for _, alert := range alerts {
+		if int64(alert.End) <= now {
+			continue
+		}
+		alert.StartTime = time.Unix(int64(alert.Start), 0).In(zone).Format("Mon 2 Jan 15:04")
+		alert.EndTime = time.Unix(int64(alert.End), 0).In(zone).Format("Mon 2 Jan 15:04")
+		reqWeather.Alerts = append(reqWeather.Alerts, alert)
+	}
+}
+
+// Cities are stored by their id, anything else by its coordinates rounded to about a kilometre
+func alertLocation(reqWeather definition.CurrentWeather) string {
+	if reqWeather.CityId != 0 {
+		return "city:" + strconv.Itoa(reqWeather.CityId)
+	}
+	return fmt.Sprintf("coord:%.2f,%.2f", reqWeather.Coord.Lat, reqWeather.Coord.Lon)
+}
+
+// A failed alert check is not repeated on every page, as each try spends a call of the quota. A
+// refused key is not going to work any time soon, anything else may be over in a few minutes
+func alertsRetryAt(err error, now time.Time) int64 {
+	if providerErr, ok := err.(*provider.Error); ok &&
+		(providerErr.Code == http.StatusUnauthorized || providerErr.Code == http.StatusForbidden) {
+		return now.Add(settings.ALERTSDENIEDHOURS * time.Hour).Unix()
+	}
+	return now.Add(settings.ALERTSRETRYMINUTES * time.Minute).Unix()
+}
+
+// Stored alerts are up to date for settings.ALERTSREFRESHMINUTES, or until the first of them ends
+func alertsValidUntil(alerts []*definition.Alert, now time.Time) int64 {
+	validUntil := now.Add(settings.ALERTSREFRESHMINUTES * time.Minute).Unix()
+	for _, alert := range alerts {
+		if end := int64(alert.End); end > now.Unix() && end < validUntil {
+			validUntil = end
+		}
+	}
+	return validUntil
+}
+
+// Sun times of the observation's local day, worked out from its coordinates
+func daylightOf(reqWeather definition.CurrentWeather) *definition.Daylight {
+	if reqWeather.Coord == nil || reqWeather.Dt == 0 {
+		return nil
+	}
+
+	local := time.Unix(int64(reqWeather.Dt), 0).In(time.FixedZone("", reqWeather.Timezone))
+	sun := astro.Sun(local.Year(), local.Month(), local.Day(), float64(reqWeather.Coord.Lat), float64(reqWeather.Coord.Lon))
+
+	return &definition.Daylight{
+		Sunrise:      unixTime(sun.Sunrise),
+		Sunset:       unixTime(sun.Sunset),
+		SolarNoon:    unixTime(sun.SolarNoon),
+		DayLength:    int(sun.DayLength().Seconds()),
+		CivilDawn:    unixTime(sun.CivilDawn),
+		CivilDusk:    unixTime(sun.CivilDusk),
+		NauticalDawn: unixTime(sun.NauticalDawn),
+		NauticalDusk: unixTime(sun.NauticalDusk),
+		PolarDay:     sun.PolarDay,
+		PolarNight:   sun.PolarNight,
+	}
+}
+
+// Moon phase, moon times and golden and blue hours of the observation's local day. The moon phase
+// is the one at the time of the observation
+func astronomyOf(reqWeather definition.CurrentWeather) *definition.Astronomy {
+	if reqWeather.Coord == nil || reqWeather.Dt == 0 {
+		return nil
+	}
+
+	lat, lon := float64(reqWeather.Coord.Lat), float64(reqWeather.Coord.Lon)
+	local := time.Unix(int64(reqWeather.Dt), 0).In(time.FixedZone("", reqWeather.Timezone))
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+
+	moon := astro.Moon(local)
+	moonTimes := astro.MoonRiseSet(midnight, lat, lon)
+	light := astro.Light(local.Year(), local.Month(), local.Day(), lat, lon)
+
+	return &definition.Astronomy{
+		MoonPhase:         float32(math.Round(moon.Phase*100) / 100),
+		MoonPhaseName:     moon.Name(),
+		MoonIllumination:  int(math.Round(moon.Fraction * 100)),
+		Moonrise:          unixTime(moonTimes.Rise),
+		Moonset:           unixTime(moonTimes.Set),
+		MoonAlwaysUp:      moonTimes.AlwaysUp,
+		MoonAlwaysDown:    moonTimes.AlwaysDown,
+		MorningBlueHour:   timeWindow(light.MorningBlueHour),
+		MorningGoldenHour: timeWindow(light.MorningGoldenHour),
+		EveningGoldenHour: timeWindow(light.EveningGoldenHour),
+		EveningBlueHour:   timeWindow(light.EveningBlueHour),
+	}
+}
+
+// Window as Unix times, or nil when it does not happen
+func timeWindow(window astro.Window) *definition.TimeWindow {
+	if window.IsZero() {
+		return nil
+	}
+	return &definition.TimeWindow{Start: unixTime(window.Start), End: unixTime(window.End)}
+}
+
+// Unix time of 't', or 0 when it is not set
+func unixTime(t time.Time) int {
+	if t.IsZero() {
+		return 0
+	}
+	return int(t.Unix())
+}
+
+// Unit preferences of the logged in user, falling back to the defaults
+func userPreferences(w http.ResponseWriter, r *http.Request) definition.Preferences {
+	username, _ := session.ReadCookieHandler(w, r)
+	return preferencesOf(username)
+}
+
+func preferencesOf(username string) definition.Preferences {
+	if prefs := helper.GetUserPreferences(username); units.Valid(prefs) {
+		return prefs
+	}
+	return units.Default
+}
+
+// The language chosen by the user in their preferences, otherwise the one their browser prefers
+func language(w http.ResponseWriter, r *http.Request) string {
+	username := ""
+	if _, err := r.Cookie("session"); err == nil {
+		username, _ = session.ReadCookieHandler(w, r)
+	}
+	return languageOf(username, r)
+}
+
+func languageOf(username string, r *http.Request) string {
+	if lang := helper.GetUserPreferences(username).Language; username != "" && i18n.Supported(lang) {
+		return lang
+	}
+	return i18n.FromAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// Templates are parsed with the 'T' function, which translates a message into the language of
+// the request, e.g. {{T "nav.search"}}
+func parseTemplate(w http.ResponseWriter, r *http.Request, name string) (*template.Template, error) {
+	lang := language(w, r)
+	funcs := template.FuncMap{
+		"T": func(key string) string {
+			return i18n.T(lang, key)
+		},
+		"languages": i18n.Languages,
+		"languageName": func(code string) string {
+			return i18n.T(code, "language.name")
+		},
+		// Unix time in the local time of a city, e.g. {{localTime .Sys.Sunrise .Timezone}}
+		"localTime": func(unix int, offset int) string {
+			if unix == 0 {
+				return ""
+			}
+			return time.Unix(int64(unix), 0).In(time.FixedZone("", offset)).Format("15:04")
+		},
+		"utcOffset": func(offset int) string {
+			sign := "+"
+			if offset < 0 {
+				sign, offset = "-", -offset
+			}
+			return fmt.Sprintf("UTC%s%02d:%02d", sign, offset/3600, offset%3600/60)
+		},
+		"duration": func(seconds int) string {
+			return fmt.Sprintf("%dh %02dm", seconds/3600, seconds%3600/60)
+		},
+	}
+	return template.New(name).Funcs(funcs).ParseFiles(filepath.Join(TemplateDir, name))
+}
+
+// Convert a provider error into the error code and message shown to the user, in their language.
+// A weather service that is down, slow, out of quota or refusing the key gets its own code,
+// anything else is reported as not found, as the OpenWeatherMap API did before
+func providerError(lang string, err error) (int, string) {
+	var apiError *provider.Error
+	var ambiguous *provider.AmbiguousZipError
+	var timeout *provider.TimeoutError
+	var unavailable *provider.UnavailableError
+	var circuitOpen *provider.CircuitOpenError
+	if err == provider.ErrNotFound {
+		return 404, i18n.T(lang, "search.err_not_found")
+	} else if err == errZipNotFound {
+		return 404, i18n.T(lang, "search.err_zip_not_found")
+	} else if err == helper.ErrNoCities {
+		return 503, i18n.T(lang, "search.err_no_cities")
+	} else if errors.As(err, &apiError) && apiError.Code == 400 {
+		return 400, i18n.T(lang, "search.err_bad_request")
+	} else if errors.As(err, &ambiguous) {
+		return 400, ambiguousZipMessage(lang, ambiguous)
+	} else if err == provider.ErrQuotaExceeded {
+		return 429, i18n.T(lang, "search.err_quota")
+	} else if errors.As(err, &timeout) {
+		return 504, i18n.T(lang, "search.err_timeout")
+	} else if errors.As(err, &unavailable) || errors.As(err, &circuitOpen) || (errors.As(err, &apiError) && apiError.Refused()) {
+		return 503, i18n.T(lang, "search.err_unavailable")
+	}
+	return 404, i18n.T(lang, "search.err_failed")
+}
+
+// Message shown on the search and forecast pages for an error from providerError(). Trying again
+// is only suggested when the search itself failed
+func searchErrorMessage(lang string, code int, message string) string {
+	switch code {
+	case 429, 503, 504:
+		return message
+	}
+	return fmt.Sprintf(i18n.T(lang, "search.try_again"), message)
+}
+
+func zipError(err error) error {
+	if err == provider.ErrNotFound {
+		return errZipNotFound
+	}
+	return err
+}
+
+func ambiguousZipMessage(lang string, err *provider.AmbiguousZipError) string {
+	return fmt.Sprintf(i18n.T(lang, "search.err_zip_ambiguous"), err.Zip, strings.Join(err.Countries, ", "), err.Zip, err.Countries[0])
+}
+
 func checkErr(message string, err error) {
 	if err != nil {
 		log.Printf("%s> %s", message, err.Error())
@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"database/sql"
+	"definition"
+	"encoding/json"
+	"fmt"
+	"helper"
+	"html/template"
+	"i18n"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"provider"
+	"reflect"
+	"session"
+	"strings"
+	"testing"
+)
+
+// The handlers are tested against the provider responses recorded in testdata/fixtures, which
+// include OpenWeatherMap's 404 for "Nowhereville". Run the server with '-fixtures record' and
+// FIXTUREDIR set to that directory to record them again
+const (
+	testUsername = "fixtures"
+	testPassword = "replay"
+)
+
+// The tables the helper package expects from the shipped 'userdb.sqlite', which the tests create
+// in a fresh one. The columns added by migrate() are included since the table is created after it
+var testUserTables = []string{
+	"CREATE TABLE IF NOT EXISTS users (username TEXT PRIMARY KEY, fullname TEXT, passwordhash TEXT, " +
+		"secretquestion TEXT, secretanswer TEXT, tempunit TEXT NOT NULL DEFAULT 'metric', " +
+		"windunit TEXT NOT NULL DEFAULT 'ms', pressureunit TEXT NOT NULL DEFAULT 'hpa', language TEXT NOT NULL DEFAULT '');",
+	"CREATE TABLE IF NOT EXISTS usersSession (username TEXT, sessionkey TEXT, logintime DATETIME DEFAULT CURRENT_TIMESTAMP);",
+	"CREATE TABLE IF NOT EXISTS usersHistory (username TEXT, sessionkey TEXT, status TEXT, " +
+		"logintime DATETIME DEFAULT CURRENT_TIMESTAMP, statusupdatedat DATETIME);",
+}
+
+// The cities of the autocomplete tests, keyed from 1. A region can have quotes in OpenWeatherMap's city list
+var testCityRegions = []string{
+	"London, GB", "London, CA", "Londonderry, GB", "New London, US", "Londrina, BR", "Posyolok \"Oktyabr'\", RU",
+}
+
+var testDB *sql.DB
+
+func TestMain(m *testing.M) {
+	// The database is created in a temporary directory, the templates and catalogs are read from the server's
+	dir, err := ioutil.TempDir("", "handler")
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbFile := filepath.Join(dir, "userdb.sqlite")
+	if err = helper.OpenDB(dbFile); err != nil {
+		log.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", dbFile+"?cache=shared&mode=rwc")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, table := range testUserTables {
+		if _, err = db.Exec(table); err != nil {
+			log.Fatal(err)
+		}
+	}
+	testDB = db
+	if !helper.CheckUsernameExists(testUsername) {
+		helper.CreateUser(testUsername, testPassword, "Fixture Replay", "question", "answer")
+	}
+
+	TemplateDir = "../server/templates"
+	i18n.CatalogDir = "../server/locales"
+	if err = provider.UseFixtures(provider.FixtureReplay, "testdata/fixtures"); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	db.Close()
+	helper.CloseDB()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// The session cookie of a logged in user, as set by the login page
+func loginCookies(t *testing.T) []*http.Cookie {
+	w := httptest.NewRecorder()
+	session.SetSession(w, httptest.NewRequest("GET", "/login", nil), testUsername, testPassword)
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("no session cookie was set")
+	}
+	return cookies
+}
+
+func serve(handler http.HandlerFunc, r *http.Request, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// The message the search and forecast pages show for a city that was not found, as escaped by the template
+func notFoundMessage() string {
+	return template.HTMLEscapeString(fmt.Sprintf(i18n.T("en", "search.try_again"), "city not found"))
+}
+
+func TestSearchHandler(t *testing.T) {
+	cookies := loginCookies(t)
+
+	tests := []struct {
+		city string
+		want []string
+	}{
+		{"Toronto", []string{"Toronto, CA", "broken clouds"}},
+		{"Nowhereville", []string{notFoundMessage()}},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/search", strings.NewReader(url.Values{"city": {test.city}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := serve(SearchHandler, r, cookies)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("search for %s: status %d", test.city, w.Code)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("search for %s does not show %q", test.city, want)
+			}
+		}
+	}
+
+	// Without a session the user is sent to the login page
+	w := serve(SearchHandler, httptest.NewRequest("POST", "/search", nil), nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Errorf("search without a session: status %d to %q, want a redirect to /login", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestForecastHandler(t *testing.T) {
+	cookies := loginCookies(t)
+
+	tests := []struct {
+		city string
+		want []string
+	}{
+		// Two days starting on Monday 16 October 2023 in Toronto, each summed up by its weather closest to noon
+		{"Toronto", []string{"Toronto", "Mon, Oct 16", "Tue, Oct 17", "clear sky"}},
+		{"Nowhereville", []string{notFoundMessage()}},
+	}
+
+	for _, test := range tests {
+		w := serve(ForecastHandler, httptest.NewRequest("GET", "/forecast?city="+test.city, nil), cookies)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("forecast for %s: status %d", test.city, w.Code)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("forecast for %s does not show %q", test.city, want)
+			}
+		}
+	}
+}
+
+func TestApiWeatherHandler(t *testing.T) {
+	token := session.CreateToken(testUsername, testPassword)
+
+	tests := []struct {
+		query      string
+		token      string
+		wantStatus int
+		wantName   string
+		wantError  string
+	}{
+		{"id=6167865", token, http.StatusOK, "Toronto", ""},
+		{"city=Toronto", token, http.StatusOK, "Toronto", ""},
+		{"city=Nowhereville", token, http.StatusNotFound, "", "city not found"},
+		{"id=toronto", token, http.StatusBadRequest, "", "'id' must be a number"},
+		{"", token, http.StatusBadRequest, "", "One of 'id', 'city', 'zip' or 'lat' and 'lon' is required"},
+		{"id=6167865&lat=43.65&lon=-79.38", token, http.StatusBadRequest, "", "Only one of 'id', 'city', 'zip' or 'lat' and 'lon' can be given"},
+		{"city=Toronto&zip=M5V,CA", token, http.StatusBadRequest, "", "Only one of 'id', 'city', 'zip' or 'lat' and 'lon' can be given"},
+		{"id=&city=Toronto", token, http.StatusOK, "Toronto", ""},
+		{"id=6167865", "", http.StatusUnauthorized, "", "Please login or send a valid bearer token"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/weather?"+test.query, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := serve(ApiWeatherHandler, r, nil)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("?%s: status %d, want %d: %s", test.query, w.Code, test.wantStatus, w.Body.String())
+			continue
+		}
+		if test.wantError != "" {
+			var response definition.ApiErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error == nil ||
+				response.Error.Message != test.wantError {
+				t.Errorf("?%s: %s, want the error %q", test.query, w.Body.String(), test.wantError)
+			}
+			continue
+		}
+
+		var reqWeather definition.CurrentWeather
+		if err := json.Unmarshal(w.Body.Bytes(), &reqWeather); err != nil {
+			t.Fatalf("?%s: %v", test.query, err)
+		}
+		if reqWeather.Name != test.wantName || reqWeather.AirQuality == nil || reqWeather.AirQuality.Aqi != 2 {
+			t.Errorf("?%s: %s, want %s with its air quality", test.query, w.Body.String(), test.wantName)
+		}
+	}
+}
+
+// Fill the 'city' table with testCityRegions for the test, and empty it afterwards
+func useTestCities(t *testing.T) {
+	for i, region := range testCityRegions {
+		if _, err := testDB.Exec("INSERT INTO city (id, key, region) VALUES (?, ?, ?);", i+1, i+1, region); err != nil {
+			t.Fatal(err)
+		}
+	}
+	helper.ReloadCityIndex()
+
+	t.Cleanup(func() {
+		testDB.Exec("DELETE FROM city;")
+		helper.ReloadCityIndex()
+	})
+}
+
+// The option of a city of testCityRegions, as the autocomplete lists it
+func cityOption(region string, suggestion bool) definition.CityOption {
+	for i, known := range testCityRegions {
+		if known == region {
+			return definition.CityOption{Value: i + 1, Label: region, Suggestion: suggestion}
+		}
+	}
+	panic("not a test city: " + region)
+}
+
+func TestCityHandler(t *testing.T) {
+	useTestCities(t)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		want       []definition.CityOption
+	}{
+		{"search=london", http.StatusOK, []definition.CityOption{
+			cityOption("London, GB", false), cityOption("London, CA", false), cityOption("Londonderry, GB", false),
+			cityOption("New London, US", false), cityOption("Londrina, BR", true),
+		}},
+		// The page goes on from the cities starting with the term to the suggestions
+		{"search=london&limit=2&offset=3", http.StatusOK, []definition.CityOption{
+			cityOption("New London, US", false), cityOption("Londrina, BR", true),
+		}},
+		{"search=london&offset=5", http.StatusOK, []definition.CityOption{}},
+		{"search=london&country=CA", http.StatusOK, []definition.CityOption{cityOption("London, CA", false)}},
+		{"search=posyolok", http.StatusOK, []definition.CityOption{cityOption("Posyolok \"Oktyabr'\", RU", false)}},
+		{"", http.StatusOK, []definition.CityOption{}},
+		{"search=+", http.StatusOK, []definition.CityOption{}},
+		{"search=london&limit=0", http.StatusBadRequest, nil},
+		{"search=london&limit=51", http.StatusBadRequest, nil},
+		{"search=london&limit=five", http.StatusBadRequest, nil},
+		{"search=london&offset=-1", http.StatusBadRequest, nil},
+		{"search=london&offset=1001", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		w := serve(CityHandler, httptest.NewRequest("GET", "/citylist.json?"+test.query, nil), nil)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("?%s: status %d, want %d: %s", test.query, w.Code, test.wantStatus, w.Body.String())
+			continue
+		}
+		if test.want == nil {
+			continue
+		}
+		// An empty list is [] rather than null for the autocomplete
+		var options []definition.CityOption
+		if err := json.Unmarshal(w.Body.Bytes(), &options); err != nil || options == nil {
+			t.Errorf("?%s: %s is not a JSON list: %v", test.query, w.Body.String(), err)
+			continue
+		}
+		if !reflect.DeepEqual(options, test.want) {
+			t.Errorf("?%s: %s, want %v", test.query, w.Body.String(), test.want)
+		}
+	}
+}
+
+func TestProviderError(t *testing.T) {
+	ambiguous := &provider.AmbiguousZipError{Zip: "10001", Countries: []string{"US", "DE"}}
+
+	tests := []struct {
+		lang     string
+		err      error
+		wantCode int
+		want     string
+	}{
+		{"en", provider.ErrNotFound, 404, "city not found"},
+		{"fr", provider.ErrNotFound, 404, "ville introuvable"},
+		{"de", errZipNotFound, 404, "Postleitzahl nicht gefunden"},
+		{"en", ambiguous, 400, "postal code 10001 is used in several countries (US, DE), please add the country as in '10001, US'"},
+		{"es", ambiguous, 400, "el código postal 10001 se usa en varios países (US, DE), añada el país como en «10001, US»"},
+		{"fr", provider.ErrQuotaExceeded, 429, i18n.T("fr", "search.err_quota")},
+		{"de", &provider.TimeoutError{}, 504, i18n.T("de", "search.err_timeout")},
+		{"en", &provider.Error{Code: 400, Message: "Nothing to geocode"}, 400, i18n.T("en", "search.err_bad_request")},
+		// A refused key or too many calls is the service's problem, not the location's
+		{"en", &provider.Error{Code: 401, Message: "Invalid API key"}, 503, i18n.T("en", "search.err_unavailable")},
+		{"fr", &provider.Error{Code: 429, Message: "Too many requests"}, 503, i18n.T("fr", "search.err_unavailable")},
+		{"es", helper.ErrNoCities, 503, i18n.T("es", "search.err_no_cities")},
+	}
+
+	for _, test := range tests {
+		code, message := providerError(test.lang, test.err)
+		if code != test.wantCode || message != test.want {
+			t.Errorf("providerError(%s, %T) = %d %q, want %d %q", test.lang, test.err, code, message, test.wantCode, test.want)
+		}
+	}
+}
+
+// Open-Meteo only reports codes, so its descriptions are translated into the language of the request
+func TestTranslateConditions(t *testing.T) {
+	tests := []struct {
+		lang    string
+		weather definition.Weather
+		want    string
+	}{
+		{"fr", definition.Weather{DescriptionKey: "light_rain"}, i18n.T("fr", "condition.light_rain")},
+		{"", definition.Weather{DescriptionKey: "clear_sky"}, "clear sky"},
+		// OpenWeatherMap's descriptions already are in the language asked for
+		{"de", definition.Weather{Description: "Manchmal Regen"}, "Manchmal Regen"},
+	}
+
+	for _, test := range tests {
+		weather := test.weather
+		translateConditions([]*definition.Weather{&weather}, test.lang)
+		if weather.Description != test.want {
+			t.Errorf("%s, %+v: %q, want %q", test.lang, test.weather, weather.Description, test.want)
+		}
+	}
+	if i18n.T("fr", "condition.light_rain") == "light rain" {
+		t.Error("condition.light_rain has no French message")
+	}
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"definition"
+	"helper"
+	"i18n"
+	"net/http"
+	"session"
+	"units"
+)
+
+// Logged in users can choose the units for temperature, wind speed and pressure, and the language
+func PreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var val = HtmlResponse{}
+
+	if isValidSession, _ := session.VerifySession(w, r); isValidSession {
+		val.UserStatus = "loggedin"
+		username, _ := session.ReadCookieHandler(w, r)
+
+		if r.Method == "POST" {
+			r.ParseForm()
+			prefs := definition.Preferences{
+				Temperature: r.Form.Get("temperature"),
+				WindSpeed:   r.Form.Get("windspeed"),
+				Pressure:    r.Form.Get("pressure"),
+				Language:    r.Form.Get("language"),
+			}
+
+			if units.Valid(prefs) && (prefs.Language == "" || i18n.Supported(prefs.Language)) {
+				helper.UpdateUserPreferences(username, prefs)
+				val.Result = i18n.T(language(w, r), "prefs.saved")
+			} else {
+				val.Result = i18n.T(language(w, r), "prefs.invalid")
+			}
+		}
+
+		val.Preferences = userPreferences(w, r)
+		t, err := parseTemplate(w, r, "preferences.html")
+		checkErr("Template parsefile error", err)
+		t.Execute(w, val)
+	} else {
+		http.Redirect(w, r, "/login", 302)
+	}
+}
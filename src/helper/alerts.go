@@ -0,0 +1,72 @@
+package helper
+
+import (
+	"definition"
+	"time"
+)
+
+// Retrieve the weather alerts stored for a location, e.g. "city:6167865". False is returned when
+// the location was never checked or its alerts are out of date, so they have to be fetched again
+func GetStoredAlerts(location string) ([]*definition.Alert, bool) {
+	var validUntil int64
+	err := db.QueryRow("SELECT validuntil FROM alertChecks WHERE location = ?;", location).Scan(&validUntil)
+	if err != nil || validUntil <= time.Now().Unix() {
+		return nil, false
+	}
+
+	query, err := db.Query("SELECT sender, event, severity, start, end, description FROM weatherAlerts WHERE location = ? ORDER BY start;", location)
+	checkErr("Db query error in GetStoredAlerts()", err)
+	if err != nil {
+		return nil, false
+	}
+
+	var alerts []*definition.Alert
+
+	for query.Next() {
+		alert := &definition.Alert{}
+		err = query.Scan(&alert.SenderName, &alert.Event, &alert.Severity, &alert.Start, &alert.End, &alert.Description)
+		checkErr("Query scan error in GetStoredAlerts()", err)
+		alerts = append(alerts, alert)
+	}
+	query.Close()
+
+	return alerts, true
+}
+
+// Replace the alerts stored for a location, they are considered up to date until 'validUntil' (Unix time)
+func StoreAlerts(location string, alerts []*definition.Alert, validUntil int64) {
+	tx, err := db.Begin()
+	checkErr("Db begin error in StoreAlerts()", err)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM weatherAlerts WHERE location = ?;", location)
+
+	for _, alert := range alerts {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT INTO weatherAlerts (location, sender, event, severity, start, end, description) VALUES (?, ?, ?, ?, ?, ?, ?);",
+			location, alert.SenderName, alert.Event, alert.Severity, alert.Start, alert.End, alert.Description)
+	}
+
+	if err == nil {
+		_, err = tx.Exec("INSERT OR REPLACE INTO alertChecks (location, validuntil) VALUES (?, ?);", location, validUntil)
+	}
+	if err != nil {
+		// Nothing is stored, so the alerts are fetched again next time
+		checkErr("Db exec error in StoreAlerts()", err)
+		tx.Rollback()
+		return
+	}
+
+	checkErr("Db commit error in StoreAlerts()", tx.Commit())
+}
+
+// Record a failed alert check of a location, so the alerts are not fetched again until
+// 'validUntil' (Unix time). The alerts stored from an earlier check are kept
+func DeferAlertCheck(location string, validUntil int64) {
+	_, err := db.Exec("INSERT OR REPLACE INTO alertChecks (location, validuntil) VALUES (?, ?);", location, validUntil)
+	checkErr("Db exec error in DeferAlertCheck()", err)
+}
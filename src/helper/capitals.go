@@ -0,0 +1,42 @@
+package helper
+
+// National capitals as their regions appear in the 'city' table (OpenWeatherMap's names), they are
+// ranked first in the city autocomplete
+var capitalRegions = []string{
+	// Europe
+	"Amsterdam, NL", "Andorra la Vella, AD", "Athens, GR", "Belgrade, RS", "Berlin, DE", "Bern, CH",
+	"Bratislava, SK", "Brussels, BE", "Bucharest, RO", "Budapest, HU", "Chisinau, MD", "Copenhagen, DK",
+	"Dublin, IE", "Helsinki, FI", "Kyiv, UA", "Lisbon, PT", "Ljubljana, SI", "London, GB",
+	"Luxembourg, LU", "Madrid, ES", "Minsk, BY", "Monaco, MC", "Moscow, RU", "Nicosia, CY", "Oslo, NO",
+	"Paris, FR", "Podgorica, ME", "Prague, CZ", "Reykjavik, IS", "Riga, LV", "Rome, IT",
+	"San Marino, SM", "Sarajevo, BA", "Skopje, MK", "Sofia, BG", "Stockholm, SE", "Tallinn, EE",
+	"Tirana, AL", "Vaduz, LI", "Valletta, MT", "Vienna, AT", "Vilnius, LT", "Warsaw, PL", "Zagreb, HR",
+	// Asia
+	"Abu Dhabi, AE", "Amman, JO", "Ankara, TR", "Ashgabat, TM", "Astana, KZ", "Baghdad, IQ", "Baku, AZ",
+	"Bangkok, TH", "Beijing, CN", "Beirut, LB", "Bishkek, KG", "Colombo, LK", "Damascus, SY", "Dhaka, BD",
+	"Dili, TL", "Doha, QA", "Dushanbe, TJ", "Hanoi, VN", "Islamabad, PK", "Jakarta, ID", "Jerusalem, IL",
+	"Kabul, AF", "Kathmandu, NP", "Kuala Lumpur, MY", "Kuwait City, KW", "Manama, BH", "Manila, PH",
+	"Muscat, OM", "Naypyidaw, MM", "New Delhi, IN", "Phnom Penh, KH", "Pyongyang, KP", "Riyadh, SA",
+	"Sanaa, YE", "Seoul, KR", "Singapore, SG", "Taipei, TW", "Tashkent, UZ", "Tbilisi, GE", "Tehran, IR",
+	"Thimphu, BT", "Tokyo, JP", "Ulaanbaatar, MN", "Vientiane, LA", "Yerevan, AM",
+	// Africa
+	"Abuja, NG", "Accra, GH", "Addis Ababa, ET", "Algiers, DZ", "Antananarivo, MG", "Asmara, ER",
+	"Bamako, ML", "Bangui, CF", "Banjul, GM", "Bissau, GW", "Brazzaville, CG", "Cairo, EG", "Conakry, GN",
+	"Dakar, SN", "Djibouti, DJ", "Dodoma, TZ", "Freetown, SL", "Gaborone, BW", "Gitega, BI", "Harare, ZW",
+	"Juba, SS", "Kampala, UG", "Khartoum, SD", "Kigali, RW", "Kinshasa, CD", "Libreville, GA",
+	"Lilongwe, MW", "Lomé, TG", "Luanda, AO", "Lusaka, ZM", "Malabo, GQ", "Maputo, MZ", "Maseru, LS",
+	"Mbabane, SZ", "Mogadishu, SO", "Monrovia, LR", "Moroni, KM", "N'Djamena, TD", "Nairobi, KE",
+	"Niamey, NE", "Nouakchott, MR", "Ouagadougou, BF", "Port Louis, MU", "Porto-Novo, BJ", "Praia, CV",
+	"Pretoria, ZA", "Rabat, MA", "São Tomé, ST", "Tripoli, LY", "Tunis, TN", "Victoria, SC",
+	"Windhoek, NA", "Yamoussoukro, CI", "Yaoundé, CM",
+	// Americas
+	"Asunción, PY", "Belmopan, BZ", "Bogotá, CO", "Brasília, BR", "Bridgetown, BB", "Buenos Aires, AR",
+	"Caracas, VE", "Georgetown, GY", "Guatemala City, GT", "Havana, CU", "Kingston, JM", "La Paz, BO",
+	"Lima, PE", "Managua, NI", "Mexico City, MX", "Montevideo, UY", "Nassau, BS", "Ottawa, CA",
+	"Panamá, PA", "Paramaribo, SR", "Port of Spain, TT", "Port-au-Prince, HT", "Quito, EC",
+	"San José, CR", "San Salvador, SV", "Santiago, CL", "Santo Domingo, DO", "Tegucigalpa, HN",
+	"Washington, D.C., US",
+	// Oceania
+	"Apia, WS", "Canberra, AU", "Honiara, SB", "Nuku'alofa, TO", "Port Moresby, PG", "Port Vila, VU",
+	"Suva, FJ", "Wellington, NZ",
+}
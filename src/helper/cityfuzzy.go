@@ -0,0 +1,373 @@
+package helper
+
+import (
+	"definition"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Most cities whose edit distance match() works out for a term, taken by the number of trigrams
+// they share with it. A short term shares a trigram like " sa" with tens of thousands of cities, but
+// a swap of two letters leaves "San Jsoe" with as many trigrams of "San Jose" as of every other
+// "San J..." city, so the cut is kept well above the size of such groups
+const maxFuzzyCandidates = 5000
+
+// A city of the fuzzy index, with its name folded by foldCityName()
+type fuzzyCity struct {
+	key     int
+	region  string
+	name    []rune
+	country string
+}
+
+// Trigram index of the folded city names, so a misspelled search term only has to be compared
+// with the cities it shares trigrams with
+type fuzzyIndex struct {
+	cities   []fuzzyCity
+	trigrams map[string][]int32
+	capitals map[string]bool
+}
+
+var (
+	cityFuzzy      *fuzzyIndex
+	cityFuzzyMutex sync.Mutex
+)
+
+// Letters that are commonly written out in another way, e.g. "München" as "Muenchen"
+var transliterations = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "æ", "ae", "œ", "oe", "ø", "oe", "å", "aa", "þ", "th",
+)
+
+// Letters with diacritics and the letter they are folded to, when they are not transliterated
+var diacritics = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a', 'ă': 'a', 'ą': 'a', 'æ': 'a',
+	'ç': 'c', 'ć': 'c', 'č': 'c', 'ď': 'd', 'đ': 'd', 'ð': 'd', 'þ': 't',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e', 'ė': 'e', 'ę': 'e', 'ě': 'e',
+	'ğ': 'g', 'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ī': 'i', 'į': 'i', 'ı': 'i',
+	'ł': 'l', 'ľ': 'l', 'ñ': 'n', 'ń': 'n', 'ň': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ō': 'o', 'ő': 'o', 'œ': 'o',
+	'ř': 'r', 'ß': 's', 'ś': 's', 'š': 's', 'ş': 's', 'ș': 's', 'ť': 't', 'ţ': 't', 'ț': 't',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u', 'ů': 'u', 'ű': 'u', 'ų': 'u',
+	'ý': 'y', 'ÿ': 'y', 'ź': 'z', 'ż': 'z', 'ž': 'z',
+}
+
+// Lower case, transliterated and without diacritics, with punctuation turned into single spaces,
+// so "Saint-Étienne" and "saint etienne" or "München" and "Muenchen" fold to the same name
+func foldCityName(name string) string {
+	return foldName(name, true)
+}
+
+// Like foldCityName(), but without transliterating when 'transliterate' is false, i.e. "München"
+// folds to "munchen"
+func foldName(name string, transliterate bool) string {
+	name = strings.ToLower(name)
+	if transliterate {
+		name = transliterations.Replace(name)
+	}
+	folded := make([]rune, 0, len(name))
+	space := true
+	for _, r := range name {
+		if plain, ok := diacritics[r]; ok {
+			r = plain
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if !space {
+				folded = append(folded, ' ')
+			}
+			space = true
+			continue
+		}
+		folded = append(folded, r)
+		space = false
+	}
+	return strings.TrimSpace(string(folded))
+}
+
+// Up to 'limit' cities whose name is within a few typos of the search term, for when the exact
+// and prefix matches of the prefix index come up short, e.g. "Torotno" finds "Toronto, CA". A term
+// like "toronot, ca" also filters on the country, as does a country code (e.g. "CA"). The cities
+// in 'exclude' are left out, and the ones returned are marked as suggestions
+func suggestCities(searchTerm string, country string, limit int, exclude []definition.City) []definition.City {
+	name, countryPrefix := searchTerm, ""
+	if comma := strings.Index(searchTerm, ","); comma >= 0 {
+		name, countryPrefix = searchTerm[:comma], foldCityName(searchTerm[comma+1:])
+	}
+	country = foldCityName(country)
+	term := []rune(foldCityName(name))
+	if len(term) < 3 || limit <= 0 {
+		return nil
+	}
+
+	excluded := make(map[int]bool)
+	for _, city := range exclude {
+		excluded[city.Id] = true
+	}
+
+	index := getFuzzyIndex()
+	matches := index.match(term, maxTypos(len(term)))
+
+	var cities []definition.City
+	for _, match := range matches {
+		city := index.cities[match.city]
+		if excluded[city.key] || !strings.HasPrefix(city.country, countryPrefix) ||
+			(country != "" && city.country != country) {
+			continue
+		}
+		cities = append(cities, definition.City{Id: city.key, Region: city.region, Suggestion: true})
+		excluded[city.key] = true
+		if len(cities) == limit {
+			break
+		}
+	}
+	return cities
+}
+
+// The longer the term, the more typos it may have
+func maxTypos(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 6:
+		return 1
+	case length < 10:
+		return 2
+	}
+	return 3
+}
+
+type fuzzyMatch struct {
+	city     int32
+	distance int
+	shared   int
+	capital  bool
+}
+
+// The cities within 'typos' edits of the term, either as a whole or of the name's first letters
+// since the user may still be typing. They are ordered by distance, then capitals first, then by
+// the number of shared trigrams
+func (index *fuzzyIndex) match(term []rune, typos int) []fuzzyMatch {
+	termTrigrams := trigrams(term)
+
+	// Counted per city of the index, which is much faster than a map for the common trigrams
+	shared := make([]uint8, len(index.cities))
+	var touched []int32
+	for _, trigram := range termTrigrams {
+		for _, city := range index.trigrams[trigram] {
+			if shared[city] == 0 {
+				touched = append(touched, city)
+			}
+			if shared[city] < 255 {
+				shared[city]++
+			}
+		}
+	}
+
+	// Each edit changes at most 4 trigrams (a transposition), so a city sharing fewer cannot match
+	minShared := len(termTrigrams) - 4*typos
+	if minShared < 1 {
+		minShared = 1
+	}
+
+	// The candidates by their number of shared trigrams, the most first. Where maxFuzzyCandidates
+	// cuts, the cities are taken in index order so the cut is the same every time
+	byShared := make([][]int32, len(termTrigrams)+1)
+	for _, city := range touched {
+		if count := int(shared[city]); count >= minShared {
+			byShared[count] = append(byShared[count], city)
+		}
+	}
+
+	var matches []fuzzyMatch
+	var rows []int
+	candidates := 0
+	for count := len(byShared) - 1; count >= minShared && candidates < maxFuzzyCandidates; count-- {
+		cities := byShared[count]
+		if len(cities) > maxFuzzyCandidates-candidates {
+			sort.Slice(cities, func(i, j int) bool { return cities[i] < cities[j] })
+			cities = cities[:maxFuzzyCandidates-candidates]
+		}
+		candidates += len(cities)
+
+		for _, city := range cities {
+			name := index.cities[city].name
+			var distance int
+			distance, rows = editDistance(term, name, typos, rows)
+			if len(name) > len(term) && len(term) >= 4 {
+				var prefix int
+				if prefix, rows = editDistance(term, name[:len(term)], typos, rows); prefix < distance {
+					distance = prefix
+				}
+			}
+			if distance > typos {
+				continue
+			}
+			matches = append(matches, fuzzyMatch{
+				city: city, distance: distance, shared: count, capital: index.capitals[index.cities[city].region],
+			})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		if a.capital != b.capital {
+			return a.capital
+		}
+		if a.shared != b.shared {
+			return a.shared > b.shared
+		}
+		return index.cities[a.city].region < index.cities[b.city].region
+	})
+	return matches
+}
+
+// The trigrams of a folded name, padded with a space on each side so the first and last letters
+// count as much as the others
+func trigrams(name []rune) []string {
+	padded := append(append([]rune{' '}, name...), ' ')
+	var grams []string
+	seen := make(map[string]bool)
+	for i := 0; i+3 <= len(padded); i++ {
+		gram := string(padded[i : i+3])
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+	return grams
+}
+
+// The number of insertions, deletions, substitutions and swaps of neighbouring letters that turn
+// 'a' into 'b' (optimal string alignment distance). Anything above 'bound' is returned as bound+1.
+// Only three rows of the table are kept since a swap looks two rows back, they are taken from
+// 'rows' when it is large enough, which is returned for the next call
+func editDistance(a []rune, b []rune, bound int, rows []int) (int, []int) {
+	if diff := len(a) - len(b); diff > bound || -diff > bound {
+		return bound + 1, rows
+	}
+
+	width := len(b) + 1
+	if len(rows) < 3*width {
+		rows = make([]int, 3*width)
+	}
+	previous2, previous, current := rows[:width], rows[width:2*width], rows[2*width:3*width]
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && previous2[j-2]+1 < d {
+				d = previous2[j-2] + 1
+			}
+			current[j] = d
+			if d < rowMin {
+				rowMin = d
+			}
+		}
+		if rowMin > bound {
+			return bound + 1, rows
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+
+	if previous[len(b)] > bound {
+		return bound + 1, rows
+	}
+	return previous[len(b)], rows
+}
+
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// Load the 'city' table into the trigram index of the "did you mean" suggestions, so the first
+// misspelled search does not wait for it
+func LoadCityFuzzyIndex() {
+	start := time.Now()
+	index := getFuzzyIndex()
+	log.Printf("Loaded %d cities for the suggestions in %s", len(index.cities), time.Since(start))
+}
+
+// Drop the fuzzy index so it is rebuilt with the current contents of the 'city' table
+func reloadFuzzyIndex() {
+	cityFuzzyMutex.Lock()
+	cityFuzzy = nil
+	cityFuzzyMutex.Unlock()
+}
+
+func getFuzzyIndex() *fuzzyIndex {
+	cityFuzzyMutex.Lock()
+	defer cityFuzzyMutex.Unlock()
+
+	if cityFuzzy == nil {
+		cityFuzzy = loadFuzzyIndex()
+	}
+	return cityFuzzy
+}
+
+func loadFuzzyIndex() *fuzzyIndex {
+	query, err := db.Query("SELECT key, region FROM city;")
+	checkErr("Db query error in loadFuzzyIndex()", err)
+	if err != nil {
+		return newFuzzyIndex(nil)
+	}
+
+	var cities []definition.City
+	for query.Next() {
+		var city definition.City
+		err = query.Scan(&city.Id, &city.Region)
+		checkErr("Query scan error in loadFuzzyIndex()", err)
+		cities = append(cities, city)
+	}
+	query.Close()
+
+	return newFuzzyIndex(cities)
+}
+
+// The name of a city is its region without the country code, e.g. "Toronto" of "Toronto, CA"
+func newFuzzyIndex(cities []definition.City) *fuzzyIndex {
+	index := &fuzzyIndex{trigrams: make(map[string][]int32), capitals: make(map[string]bool)}
+	for _, region := range capitalRegions {
+		index.capitals[region] = true
+	}
+
+	for _, c := range cities {
+		city := fuzzyCity{key: c.Id, region: c.Region}
+		name := city.region
+		if comma := strings.LastIndex(name, ","); comma >= 0 {
+			name, city.country = name[:comma], foldCityName(name[comma+1:])
+		}
+		city.name = []rune(foldCityName(name))
+		if len(city.name) == 0 {
+			continue
+		}
+
+		id := int32(len(index.cities))
+		index.cities = append(index.cities, city)
+		for _, trigram := range trigrams(city.name) {
+			index.trigrams[trigram] = append(index.trigrams[trigram], id)
+		}
+	}
+
+	return index
+}
@@ -0,0 +1,190 @@
+package helper
+
+import (
+	"definition"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// Cities of the in-memory indexes the search tests are run against, keyed from 1
+var testRegions = []string{
+	"Toronto, CA", "München, DE", "Weißenburg, DE", "London, GB", "London, CA", "Londrina, BR",
+	"Mississauga, CA", "Ottawa, CA", "Saint-Étienne, FR",
+}
+
+func testCities(regions []string) []definition.City {
+	var cities []definition.City
+	for i, region := range regions {
+		cities = append(cities, definition.City{Id: i + 1, Region: region})
+	}
+	return cities
+}
+
+// Serve the city searches of a test from the given regions instead of the 'city' table
+func useTestCities(t *testing.T, regions []string) {
+	cities := testCities(regions)
+	cityPrefixMutex.Lock()
+	cityPrefix = newPrefixIndex(cities)
+	cityPrefixMutex.Unlock()
+	cityFuzzyMutex.Lock()
+	cityFuzzy = newFuzzyIndex(cities)
+	cityFuzzyMutex.Unlock()
+
+	t.Cleanup(func() {
+		reloadPrefixIndex()
+		reloadFuzzyIndex()
+	})
+}
+
+func regionsOf(cities []definition.City) []string {
+	var regions []string
+	for _, city := range cities {
+		regions = append(regions, city.Region)
+	}
+	return regions
+}
+
+func TestFoldName(t *testing.T) {
+	tests := []struct {
+		name          string
+		transliterate bool
+		want          string
+	}{
+		{"München", true, "muenchen"},
+		{"München", false, "munchen"},
+		{"Weißenburg", true, "weissenburg"},
+		{"Weißenburg", false, "weisenburg"},
+		{"Saint-Étienne", true, "saint etienne"},
+		{"  St. John's, CA ", true, "st john s ca"},
+		{"--", true, ""},
+	}
+
+	for _, test := range tests {
+		if got := foldName(test.name, test.transliterate); got != test.want {
+			t.Errorf("foldName(%q, %v) = %q, want %q", test.name, test.transliterate, got, test.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a     string
+		b     string
+		bound int
+		want  int
+	}{
+		{"toronto", "toronto", 2, 0},
+		// A swap of neighbouring letters is a single edit
+		{"torotno", "toronto", 2, 1},
+		{"toront", "toronto", 2, 1},
+		{"kitten", "sitting", 3, 3},
+		// Above the bound the distance is bound+1, whether the lengths are too far apart or a row
+		// of the table is already above it
+		{"kitten", "sitting", 2, 3},
+		{"ab", "abcdef", 1, 2},
+		{"abcdef", "uvwxyz", 2, 3},
+	}
+
+	// The rows are reused from one call to the next, like match() does
+	var rows []int
+	for _, test := range tests {
+		var got int
+		got, rows = editDistance([]rune(test.a), []rune(test.b), test.bound, rows)
+		if got != test.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", test.a, test.b, test.bound, got, test.want)
+		}
+	}
+}
+
+func TestFuzzyIndexMatch(t *testing.T) {
+	index := newFuzzyIndex(testCities(testRegions))
+
+	tests := []struct {
+		term  string
+		typos int
+		want  []string
+	}{
+		// Capitals first among the cities as far away, then the most shared trigrams, then the region
+		{"londn", 1, []string{"London, GB 1", "London, CA 1", "Londrina, BR 1"}},
+		{"torotno", 2, []string{"Toronto, CA 1"}},
+		// The start of a longer name counts, since the user may still be typing
+		{"misi", 1, []string{"Mississauga, CA 1"}},
+		{"muenchen", 2, []string{"München, DE 0"}},
+		{"xyz", 0, nil},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, match := range index.match([]rune(test.term), test.typos) {
+			got = append(got, fmt.Sprintf("%s %d", index.cities[match.city].region, match.distance))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("match(%q, %d) = %q, want %q", test.term, test.typos, got, test.want)
+		}
+	}
+}
+
+func TestFuzzyIndexMatchCandidates(t *testing.T) {
+	// More cities one edit away than there are candidates, then the city that is the term. It
+	// shares the most trigrams with the term, so it is still a candidate
+	var regions []string
+	for len(regions) < maxFuzzyCandidates+10 {
+		regions = append(regions, "Springfieldz, US")
+	}
+	regions = append(regions, "Springfield, US")
+	index := newFuzzyIndex(testCities(regions))
+
+	matches := index.match([]rune("springfield"), 2)
+	if len(matches) != maxFuzzyCandidates {
+		t.Fatalf("%d matches, want %d", len(matches), maxFuzzyCandidates)
+	}
+	if exact := int32(len(regions) - 1); matches[0].city != exact || matches[0].distance != 0 {
+		t.Errorf("the first match is city %d at %d, want city %d at 0", matches[0].city, matches[0].distance, exact)
+	}
+	// The others are cut in index order
+	for _, match := range matches[1:] {
+		if match.city >= maxFuzzyCandidates-1 {
+			t.Errorf("city %d is a candidate, want the first %d", match.city, maxFuzzyCandidates-1)
+			break
+		}
+	}
+}
+
+func TestSuggestCities(t *testing.T) {
+	useTestCities(t, testRegions)
+	londonGB := definition.City{Id: 4, Region: "London, GB"}
+
+	tests := []struct {
+		term    string
+		country string
+		limit   int
+		exclude []definition.City
+		want    []string
+	}{
+		{"Torotno", "", 5, nil, []string{"Toronto, CA"}},
+		{"Muenchen", "", 5, nil, []string{"München, DE"}},
+		{"Weissenburg", "", 5, nil, []string{"Weißenburg, DE"}},
+		{"Saint Etiene", "", 5, nil, []string{"Saint-Étienne, FR"}},
+		{"londn", "", 5, nil, []string{"London, GB", "London, CA", "Londrina, BR"}},
+		{"londn", "", 1, nil, []string{"London, GB"}},
+		{"londn, c", "", 5, nil, []string{"London, CA"}},
+		{"londn", "br", 5, nil, []string{"Londrina, BR"}},
+		{"londn", "", 5, []definition.City{londonGB}, []string{"London, CA", "Londrina, BR"}},
+		{"londn", "", 0, nil, nil},
+		// Too short to be misspelled
+		{"tor", "", 5, nil, nil},
+	}
+
+	for _, test := range tests {
+		cities := suggestCities(test.term, test.country, test.limit, test.exclude)
+		if got := regionsOf(cities); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("suggestCities(%q, %q, %d) = %q, want %q", test.term, test.country, test.limit, got, test.want)
+		}
+		for _, city := range cities {
+			if !city.Suggestion {
+				t.Errorf("suggestCities(%q) returned %s, which is not marked as a suggestion", test.term, city.Region)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package helper
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"definition"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Where OpenWeatherMap publishes the list of the cities its API knows
+const CityListUrl = "http://bulk.openweathermap.org/sample/city.list.json.gz"
+
+// An entry of city.list.json, e.g.
+// {"id":6167865,"name":"Toronto","state":"","country":"CA","coord":{"lon":-79.416298,"lat":43.700111}}
+type cityListEntry struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Country string `json:"country"`
+	Coord   *struct {
+		Lon float64 `json:"lon"`
+		Lat float64 `json:"lat"`
+	} `json:"coord"`
+}
+
+// The stored fields of a city, to tell whether an import changes it
+type storedCity struct {
+	region, name, country string
+	lat, lon              sql.NullFloat64
+}
+
+// Import OpenWeatherMap's gzipped city list from a file or an http(s) URL into the 'city' table.
+// The list is streamed, so it is never held in memory as a whole. Cities are matched on their
+// OpenWeatherMap id: known ones are updated when they changed and new ones are added after the
+// last row, so importing the same list again changes nothing. It all happens in one transaction
+func ImportCityList(source string) (definition.CityImport, error) {
+	var counts definition.CityImport
+
+	input, err := openCityList(source)
+	if err != nil {
+		return counts, err
+	}
+	defer input.Close()
+
+	unzipped, err := gzip.NewReader(input)
+	if err != nil {
+		return counts, fmt.Errorf("reading %s: %s", source, err.Error())
+	}
+	defer unzipped.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return counts, err
+	}
+
+	counts, err = importCities(tx, json.NewDecoder(unzipped))
+	if err != nil {
+		tx.Rollback()
+		return counts, err
+	}
+	if err = tx.Commit(); err != nil {
+		return counts, err
+	}
+
+	ReloadCityIndex()
+	return counts, nil
+}
+
+func openCityList(source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+
+	response, err := http.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("downloading %s: %s", source, response.Status)
+	}
+	return response.Body, nil
+}
+
+// The list is one JSON array, its entries are decoded one at a time
+func importCities(tx *sql.Tx, decoder *json.Decoder) (definition.CityImport, error) {
+	var counts definition.CityImport
+
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return counts, fmt.Errorf("the city list is not a JSON array")
+	}
+
+	var nextId int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(id), 0) + 1 FROM city;").Scan(&nextId); err != nil {
+		return counts, err
+	}
+
+	for decoder.More() {
+		var entry cityListEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return counts, fmt.Errorf("city %d of the list: %s", counts.Read+1, err.Error())
+		}
+		counts.Read++
+
+		if entry.Id <= 0 || strings.TrimSpace(entry.Name) == "" {
+			counts.Skipped++
+			continue
+		}
+
+		// Without coordinates the city is stored without them, rather than at 0,0
+		city := storedCity{name: entry.Name, country: entry.Country}
+		if entry.Coord != nil {
+			city.lat = sql.NullFloat64{Float64: entry.Coord.Lat, Valid: true}
+			city.lon = sql.NullFloat64{Float64: entry.Coord.Lon, Valid: true}
+		}
+		city.region = city.name
+		if city.country != "" {
+			city.region += ", " + city.country
+		}
+
+		var stored storedCity
+		var storedName, storedCountry sql.NullString
+		err := tx.QueryRow("SELECT region, name, country, lat, lon FROM city WHERE key = ?;", entry.Id).
+			Scan(&stored.region, &storedName, &storedCountry, &stored.lat, &stored.lon)
+		stored.name, stored.country = storedName.String, storedCountry.String
+
+		if err == sql.ErrNoRows {
+			_, err = tx.Exec("INSERT INTO city (id, key, region, name, country, lat, lon) VALUES (?, ?, ?, ?, ?, ?, ?);",
+				nextId, entry.Id, city.region, city.name, city.country, city.lat, city.lon)
+			nextId++
+			counts.Added++
+		} else if err == nil && !sameCity(stored, city) {
+			_, err = tx.Exec("UPDATE city SET region = ?, name = ?, country = ?, lat = ?, lon = ? WHERE key = ?;",
+				city.region, city.name, city.country, city.lat, city.lon, entry.Id)
+			counts.Updated++
+		} else if err == nil {
+			counts.Unchanged++
+		}
+		if err != nil {
+			return counts, fmt.Errorf("city %d: %s", entry.Id, err.Error())
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return counts, fmt.Errorf("the city list is not a JSON array: %s", err.Error())
+	}
+	return counts, nil
+}
+
+// Coordinates are compared with a tolerance, as they went through SQLite's REAL
+func sameCity(a storedCity, b storedCity) bool {
+	return a.region == b.region && a.name == b.name && a.country == b.country &&
+		a.lat.Valid == b.lat.Valid && a.lon.Valid == b.lon.Valid &&
+		math.Abs(a.lat.Float64-b.lat.Float64) < 1e-6 && math.Abs(a.lon.Float64-b.lon.Float64) < 1e-6
+}
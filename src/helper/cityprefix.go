@@ -0,0 +1,255 @@
+package helper
+
+import (
+	"container/heap"
+	"definition"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The autocomplete is served from memory, so a keystroke does not have to go to SQLite. Every word
+// of a folded region starts an entry, e.g. "new york us", "york us" and "us" for "New York, US", and
+// the entries are sorted, so the cities with a word starting with the term are one range of them.
+// Regions are folded without transliterating, like the FTS5 index does, so "munchen" finds
+// "München, DE" and "muenchen" is left to suggestCities()
+type prefixIndex struct {
+	cities  []prefixCity
+	entries []prefixEntry
+}
+
+type prefixCity struct {
+	key     int
+	region  string
+	country string
+	// Position of the city when ordered like cityRanking does after its tiers: capitals first, then
+	// by the length of the region and the region
+	order int
+}
+
+// The rank of an entry is its tier when the term is not the whole region or name: 2 when the
+// entry starts the region and 3 otherwise, times the number of cities, plus the city's order.
+// Entries that start the region have the length of the folded name, the others -1
+type prefixEntry struct {
+	key     string
+	city    int32
+	rank    int32
+	nameLen int32
+}
+
+var (
+	cityPrefix      *prefixIndex
+	cityPrefixMutex sync.Mutex
+)
+
+// Load the 'city' table into the prefix index that serves the autocomplete, so the first search
+// does not wait for it
+func LoadCityPrefixIndex() {
+	start := time.Now()
+	index := getPrefixIndex()
+	log.Printf("Loaded %d cities for the autocomplete in %s", len(index.cities), time.Since(start))
+}
+
+// Drop the prefix index so it is rebuilt with the current contents of the 'city' table
+func reloadPrefixIndex() {
+	cityPrefixMutex.Lock()
+	cityPrefix = nil
+	cityPrefixMutex.Unlock()
+}
+
+func getPrefixIndex() *prefixIndex {
+	cityPrefixMutex.Lock()
+	defer cityPrefixMutex.Unlock()
+
+	if cityPrefix == nil {
+		cityPrefix = loadPrefixIndex()
+	}
+	return cityPrefix
+}
+
+// Up to 'limit' cities with a word of the region starting with the search term, ranked in the
+// tiers of cityRanking: the region is the term, the name is the term, the region starts with the
+// term, then the others. The folded term has to match whole words in order, so "new yo" finds
+// "New York, US" but "yo new" does not. A country code (e.g. "CA") keeps the cities of that country
+func (index *prefixIndex) search(searchTerm string, country string, limit int) []definition.City {
+	term := foldName(searchTerm, false)
+	if term == "" || limit <= 0 {
+		return nil
+	}
+	country = strings.ToUpper(strings.TrimSpace(country))
+
+	first := sort.Search(len(index.entries), func(i int) bool {
+		return index.entries[i].key >= term
+	})
+
+	// The best 'limit' cities so far. A city can be in several entries, it keeps its best rank
+	best := &rankedCities{at: make(map[int32]int)}
+
+	for i := first; i < len(index.entries) && strings.HasPrefix(index.entries[i].key, term); i++ {
+		entry := &index.entries[i]
+		rank := int(entry.rank)
+
+		// The region and the name of the entry start with the term, so their length tells whether
+		// they are the term
+		if entry.nameLen >= 0 && len(entry.key) == len(term) {
+			rank -= 2 * len(index.cities)
+		} else if int(entry.nameLen) == len(term) {
+			rank -= len(index.cities)
+		}
+
+		if len(best.cities) == limit && rank >= best.cities[0].rank {
+			continue
+		}
+		if country != "" && index.cities[entry.city].country != country {
+			continue
+		}
+
+		// A city that is there already moves up if the rank is better, otherwise the worst city makes
+		// room for it
+		if known, found := best.at[entry.city]; found {
+			if rank < best.cities[known].rank {
+				best.cities[known].rank = rank
+				heap.Fix(best, known)
+			}
+		} else if len(best.cities) == limit {
+			delete(best.at, best.cities[0].city)
+			best.cities[0] = rankedCity{city: entry.city, rank: rank}
+			best.at[entry.city] = 0
+			heap.Fix(best, 0)
+		} else {
+			heap.Push(best, rankedCity{city: entry.city, rank: rank})
+		}
+	}
+
+	// Ranks are unique, the city's order is part of them
+	sort.Slice(best.cities, func(i, j int) bool { return best.cities[i].rank < best.cities[j].rank })
+	var cities []definition.City
+	for _, match := range best.cities {
+		city := index.cities[match.city]
+		cities = append(cities, definition.City{Id: city.key, Region: city.region})
+	}
+	return cities
+}
+
+type rankedCity struct {
+	city int32
+	rank int
+}
+
+// Heap of the best cities of a search with the worst one on top, so a page of a thousand cities
+// does not have to be kept in order while the entries are ranked. 'at' is the position of each
+// city in the heap
+type rankedCities struct {
+	cities []rankedCity
+	at     map[int32]int
+}
+
+func (r *rankedCities) Len() int {
+	return len(r.cities)
+}
+
+func (r *rankedCities) Less(i int, j int) bool {
+	return r.cities[i].rank > r.cities[j].rank
+}
+
+func (r *rankedCities) Swap(i int, j int) {
+	r.cities[i], r.cities[j] = r.cities[j], r.cities[i]
+	r.at[r.cities[i].city] = i
+	r.at[r.cities[j].city] = j
+}
+
+func (r *rankedCities) Push(x interface{}) {
+	city := x.(rankedCity)
+	r.at[city.city] = len(r.cities)
+	r.cities = append(r.cities, city)
+}
+
+func (r *rankedCities) Pop() interface{} {
+	city := r.cities[len(r.cities)-1]
+	r.cities = r.cities[:len(r.cities)-1]
+	delete(r.at, city.city)
+	return city
+}
+
+func loadPrefixIndex() *prefixIndex {
+	query, err := db.Query("SELECT key, region FROM city;")
+	checkErr("Db query error in loadPrefixIndex()", err)
+	if err != nil {
+		return newPrefixIndex(nil)
+	}
+
+	var cities []definition.City
+	for query.Next() {
+		var city definition.City
+		err = query.Scan(&city.Id, &city.Region)
+		checkErr("Query scan error in loadPrefixIndex()", err)
+		cities = append(cities, city)
+	}
+	query.Close()
+
+	return newPrefixIndex(cities)
+}
+
+func newPrefixIndex(cities []definition.City) *prefixIndex {
+	index := &prefixIndex{}
+
+	for _, c := range cities {
+		city := prefixCity{key: c.Id, region: c.Region}
+		name := city.region
+		if comma := strings.LastIndex(name, ","); comma >= 0 {
+			name, city.country = name[:comma], strings.ToUpper(strings.TrimSpace(name[comma+1:]))
+		}
+
+		id := int32(len(index.cities))
+		index.cities = append(index.cities, city)
+		index.addRegion(id, foldName(city.region, false), len(foldName(name, false)))
+	}
+
+	capitals := make(map[string]bool)
+	for _, region := range capitalRegions {
+		capitals[region] = true
+	}
+	order := make([]int, len(index.cities))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := index.cities[order[i]], index.cities[order[j]]
+		if capitals[a.region] != capitals[b.region] {
+			return capitals[a.region]
+		}
+		if len(a.region) != len(b.region) {
+			return len(a.region) < len(b.region)
+		}
+		return a.region < b.region
+	})
+	for position, city := range order {
+		index.cities[city].order = position
+	}
+	for i := range index.entries {
+		entry := &index.entries[i]
+		tier := 3
+		if entry.nameLen >= 0 {
+			tier = 2
+		}
+		entry.rank = int32(tier*len(index.cities) + index.cities[entry.city].order)
+	}
+
+	sort.Slice(index.entries, func(i, j int) bool {
+		return index.entries[i].key < index.entries[j].key
+	})
+	return index
+}
+
+// One entry per word of the folded region, the keys share its memory
+func (index *prefixIndex) addRegion(city int32, region string, nameLen int) {
+	for i := 0; i < len(region); i++ {
+		if i == 0 {
+			index.entries = append(index.entries, prefixEntry{key: region, city: city, nameLen: int32(nameLen)})
+		} else if region[i-1] == ' ' {
+			index.entries = append(index.entries, prefixEntry{key: region[i:], city: city, nameLen: -1})
+		}
+	}
+}
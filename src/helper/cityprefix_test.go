@@ -0,0 +1,148 @@
+package helper
+
+import (
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Search terms of the autocomplete benchmarks, from a single letter to whole regions
+var cityBenchTerms = []string{"t", "to", "tor", "toronto", "new yo", "london, gb", "münchen", "san", "xyz"}
+
+// About as many cities as OpenWeatherMap's city list has
+const benchCityCount = 200000
+
+var benchCitiesOnce sync.Once
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "helper")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = OpenDB(filepath.Join(dir, "userdb.sqlite")); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	CloseDB()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestPrefixIndexSearch(t *testing.T) {
+	index := newPrefixIndex(testCities([]string{
+		"London, GB", "London, CA", "Londonderry, GB", "London Mills, US", "New London, US", "New York, US",
+		"York, GB", "Yorkton, CA", "Washington, D.C., US", "Washington, GB", "Washingtonville, US",
+		"San Salvador, SV", "Santa Ana, US", "El Salto, MX",
+	}))
+
+	tests := []struct {
+		term    string
+		country string
+		want    []string
+	}{
+		// The name, then the regions starting with the term, then the other words
+		{"london", "", []string{"London, GB", "London, CA", "Londonderry, GB", "London Mills, US", "New London, US"}},
+		{"London, CA", "", []string{"London, CA"}},
+		{"york", "", []string{"York, GB", "Yorkton, CA", "New York, US"}},
+		// Capitals first, but only within a tier
+		{"washington", "", []string{"Washington, GB", "Washington, D.C., US", "Washingtonville, US"}},
+		// "salvador sv" comes before "san salvador sv" in the index, San Salvador keeps the rank of the latter
+		{"sa", "", []string{"San Salvador, SV", "Santa Ana, US", "El Salto, MX"}},
+		// Whole words in order
+		{"new yo", "", []string{"New York, US"}},
+		{"yo new", "", nil},
+		{"london", "gb", []string{"London, GB", "Londonderry, GB"}},
+		{"london", "CA", []string{"London, CA"}},
+		{" ", "", nil},
+	}
+
+	for _, test := range tests {
+		// A smaller page is the start of the larger one, whichever cities the heap let go
+		for limit := 1; limit <= len(test.want)+1; limit++ {
+			want := test.want
+			if limit < len(want) {
+				want = want[:limit]
+			}
+			got := regionsOf(index.search(test.term, test.country, limit))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("search(%q, %q, %d) = %q, want %q", test.term, test.country, limit, got, want)
+			}
+		}
+	}
+}
+
+// Fill the 'city' table with made-up cities, plus the ones the search terms are after, the first
+// time a benchmark needs them
+func loadBenchCities(b *testing.B) {
+	benchCitiesOnce.Do(func() {
+		syllables := []string{"to", "ron", "lon", "don", "mu", "nich", "san", "ta", "ber", "lin", "pa", "ris",
+			"ma", "drid", "ka", "no", "vi", "ra", "el", "sto", "burg", "ville", "port", "ford", "york", "new"}
+		countries := []string{"US", "CA", "GB", "DE", "FR", "ES", "IT", "MX", "BR", "IN", "CN", "RU"}
+		random := rand.New(rand.NewSource(1))
+
+		regions := []string{"Toronto, CA", "London, GB", "London, CA", "München, DE", "New York, US", "Ottawa, CA"}
+		for len(regions) < benchCityCount {
+			var words []string
+			for word := random.Intn(3); word >= 0; word-- {
+				var letters string
+				for syllable := random.Intn(2); syllable >= 0; syllable-- {
+					letters += syllables[random.Intn(len(syllables))]
+				}
+				words = append(words, strings.Title(letters))
+			}
+			regions = append(regions, strings.Join(words, " ")+", "+countries[random.Intn(len(countries))])
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			b.Fatal(err)
+		}
+		tx.Exec("DELETE FROM city;")
+		for i, region := range regions {
+			if _, err = tx.Exec("INSERT INTO city (id, key, region) VALUES (?, ?, ?);", i+1, 1000000+i, region); err != nil {
+				tx.Rollback()
+				b.Fatal(err)
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			b.Fatal(err)
+		}
+		ReloadCityIndex()
+	})
+}
+
+// The SQL search is ranked with the FTS5 index, run with '-tags sqlite_fts5'
+func BenchmarkCitySearchSQL(b *testing.B) {
+	if !citySearchFts {
+		b.Skip("SQLite has no FTS5, run with '-tags sqlite_fts5'")
+	}
+	loadBenchCities(b)
+
+	for _, term := range cityBenchTerms {
+		b.Run(term, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				searchCities(term, 5)
+			}
+		})
+	}
+}
+
+func BenchmarkCitySearchPrefix(b *testing.B) {
+	loadBenchCities(b)
+	index := getPrefixIndex()
+
+	for _, term := range cityBenchTerms {
+		b.Run(term, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				index.search(term, "", 5)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package helper
+
+import (
+	"definition"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// Whether the full-text index 'citySearch' is there. SQLite only has FTS5 when the app is built
+// with '-tags sqlite_fts5'
+var citySearchFts bool
+
+// Triggers that keep 'citySearch' in sync with the 'city' table
+var citySearchTriggers = map[string]string{
+	"citySearchInsert": "AFTER INSERT ON city BEGIN " +
+		"INSERT INTO citySearch (rowid, region) VALUES (new.id, new.region); END",
+	"citySearchDelete": "AFTER DELETE ON city BEGIN " +
+		"INSERT INTO citySearch (citySearch, rowid, region) VALUES ('delete', old.id, old.region); END",
+	"citySearchUpdate": "AFTER UPDATE ON city BEGIN " +
+		"INSERT INTO citySearch (citySearch, rowid, region) VALUES ('delete', old.id, old.region); " +
+		"INSERT INTO citySearch (rowid, region) VALUES (new.id, new.region); END",
+}
+
+// The autocomplete ranks the city whose name is the search term first, then the ones that start
+// with it, then capitals. The parameters are the exact name, the name followed by the country and
+// the prefix, all lower case and escaped for LIKE
+const cityRanking = "LOWER(c.region) = ? DESC, LOWER(c.region) LIKE ? ESCAPE '\\' DESC, " +
+	"LOWER(c.region) LIKE ? ESCAPE '\\' DESC, c.region IN (SELECT region FROM capitals) DESC"
+
+// Create the full-text index of the city regions when SQLite has FTS5. The index is rebuilt when
+// its triggers are new, i.e. the first time or after running without FTS5 for a while. Without
+// FTS5 SQLite cannot touch the index, so only its triggers are dropped, which lets commands like
+// importcities still write the 'city' table, and the SQL city search finds nothing, as logged
+func ensureCitySearch() {
+	ensureTable("capitals", "region TEXT PRIMARY KEY")
+	storeCapitals()
+
+	var fts5 bool
+	db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5');").Scan(&fts5)
+	if !fts5 {
+		for trigger := range citySearchTriggers {
+			_, err := db.Exec("DROP TRIGGER IF EXISTS " + trigger + ";")
+			checkErr("Db exec error in ensureCitySearch()", err)
+		}
+		log.Println("SQLite has no FTS5, the SQL city search needs the app built with '-tags sqlite_fts5'")
+		return
+	}
+
+	_, err := db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS citySearch USING fts5(region, content='city', " +
+		"content_rowid='id', tokenize='unicode61 remove_diacritics 2', prefix='2 3');")
+	checkErr("Db exec error in ensureCitySearch()", err)
+	if err != nil {
+		return
+	}
+
+	rebuild := false
+	for trigger, body := range citySearchTriggers {
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?;", trigger).Scan(&count)
+		if count > 0 {
+			continue
+		}
+		if _, err = db.Exec("CREATE TRIGGER " + trigger + " " + body + ";"); err != nil {
+			checkErr("Db exec error in ensureCitySearch()", err)
+			return
+		}
+		rebuild = true
+	}
+	if rebuild {
+		if _, err = db.Exec("INSERT INTO citySearch (citySearch) VALUES ('rebuild');"); err != nil {
+			checkErr("Db exec error in ensureCitySearch()", err)
+			return
+		}
+	}
+
+	citySearchFts = true
+}
+
+func storeCapitals() {
+	tx, err := db.Begin()
+	checkErr("Db begin error in storeCapitals()", err)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM capitals;")
+	for _, region := range capitalRegions {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT OR IGNORE INTO capitals (region) VALUES (?);", region)
+	}
+	if err != nil {
+		checkErr("Db exec error in storeCapitals()", err)
+		tx.Rollback()
+		return
+	}
+	checkErr("Db commit error in storeCapitals()", tx.Commit())
+}
+
+// Up to 'limit' cities matching the search term, best first. Every word of the term is a prefix of
+// a word of the region, so "new yo" finds "New York, US" and "munchen" finds "München, DE". The
+// autocomplete is served by the prefix index, which is benchmarked against this. Nothing is found
+// without FTS5
+func searchCities(searchTerm string, limit int) []definition.City {
+	term := strings.ToLower(strings.TrimSpace(searchTerm))
+	match := ftsQuery(term)
+	if match == "" || !citySearchFts {
+		return nil
+	}
+	like := escapeLike(term)
+
+	query, err := db.Query("SELECT c.key, c.region FROM citySearch JOIN city c ON c.id = citySearch.rowid "+
+		"WHERE citySearch MATCH ? ORDER BY "+cityRanking+", citySearch.rank, c.region LIMIT ?;",
+		match, term, like+",%", like+"%", limit)
+	checkErr("Db query error in searchCities()", err)
+	if err != nil {
+		return nil
+	}
+
+	var cities []definition.City
+
+	for query.Next() {
+		var city definition.City
+		err = query.Scan(&city.Id, &city.Region)
+		checkErr("Query scan error in searchCities()", err)
+		cities = append(cities, city)
+	}
+	query.Close()
+
+	return cities
+}
+
+// Each word of the term becomes a quoted prefix query, so the user cannot type FTS5 syntax
+func ftsQuery(term string) string {
+	words := strings.FieldsFunc(term, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = "\"" + word + "\"*"
+	}
+	return strings.Join(words, " ")
+}
+
+func escapeLike(term string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(term)
+}
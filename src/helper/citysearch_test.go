@@ -0,0 +1,66 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The full-text index follows the 'city' table through its triggers, and is ranked like the prefix
+// index. It needs FTS5, run with '-tags sqlite_fts5'
+func TestSearchCities(t *testing.T) {
+	if !citySearchFts {
+		t.Skip("SQLite has no FTS5, run with '-tags sqlite_fts5'")
+	}
+
+	// Rows far past the imported cities, so the other tests do not see them
+	const firstID = 900000000
+	regions := []string{"Londonderry, GB", "New London, US", "London, CA", "London, GB", "München, DE", "New York, US"}
+	for i, region := range regions {
+		if _, err := db.Exec("INSERT INTO city (id, key, region) VALUES (?, ?, ?);", firstID+i, firstID+i, region); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer db.Exec("DELETE FROM city WHERE id >= ?;", firstID)
+
+	search := func(term string) []string {
+		var found []string
+		for _, city := range searchCities(term, 5) {
+			found = append(found, city.Region)
+		}
+		return found
+	}
+
+	tests := []struct {
+		term string
+		want []string
+	}{
+		// The name before the other regions starting with it, capitals first, then the other words
+		{"london", []string{"London, GB", "London, CA", "Londonderry, GB", "New London, US"}},
+		{"london, ca", []string{"London, CA"}},
+		{"new yo", []string{"New York, US"}},
+		{"munchen", []string{"München, DE"}},
+		// FTS5 syntax is searched for as words
+		{"york OR london", nil},
+		{"\"", nil},
+		{" ", nil},
+	}
+	for _, test := range tests {
+		if got := search(test.term); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("searchCities(%q) = %q, want %q", test.term, got, test.want)
+		}
+	}
+
+	// Updated and deleted rows leave the index with them
+	if _, err := db.Exec("UPDATE city SET region = 'Lindon, US' WHERE id = ?;", firstID+1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM city WHERE id = ?;", firstID); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := search("london"), []string{"London, GB", "London, CA"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("searchCities(%q) after an update and a delete = %q, want %q", "london", got, want)
+	}
+	if got, want := search("lindon"), []string{"Lindon, US"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("searchCities(%q) after an update = %q, want %q", "lindon", got, want)
+	}
+}
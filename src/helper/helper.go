@@ -5,6 +5,8 @@ package helper
 import (
 	"log"
 	"database/sql"
+	"definition"
+	"errors"
 	"golang.org/x/crypto/bcrypt"
 	"settings"
 	_ "github.com/mattn/go-sqlite3"
@@ -12,12 +14,21 @@ import (
 	"time"
 	"math/rand"
 	"strconv"
+	"sync"
 )
 
 var (
 	db *sql.DB
+
+	// Largest id of the 'city' table, whose ids number the cities from 1. It is read at startup and
+	// again by ReloadCityIndex(), e.g. after an import
+	cityTableSize      int
+	cityTableSizeMutex sync.Mutex
 )
 
+// Returned by GetRandomCity() while the 'city' table is empty
+var ErrNoCities = errors.New("there are no cities yet, import the city list with 'go run main.go importcities'")
+
 func CreateUser(username string, password string, fullname string, question string, answer string) {
 	// A password hash is created based on the pepper defined in settings
 	passHash, err := bcrypt.GenerateFromPassword([]byte(password + settings.PEPPER), bcrypt.DefaultCost)
@@ -50,6 +61,32 @@ func ResetPassword(username string, password string) {
 	query.Close()
 }
 
+// Retrieve the unit and language preferences of a user, empty values are returned for unknown users
+func GetUserPreferences(username string) definition.Preferences {
+	query, err := db.Query("SELECT tempunit, windunit, pressureunit, language FROM users WHERE username = ?;", username)
+	checkErr("Db query error in GetUserPreferences()", err)
+
+	var prefs definition.Preferences
+
+	for query.Next() {
+		err = query.Scan(&prefs.Temperature, &prefs.WindSpeed, &prefs.Pressure, &prefs.Language)
+		checkErr("Query scan error in GetUserPreferences()", err)
+	}
+	query.Close()
+
+	return prefs
+}
+
+func UpdateUserPreferences(username string, prefs definition.Preferences) {
+	query, errDb := db.Prepare("UPDATE users SET tempunit = ?, windunit = ?, pressureunit = ?, language = ? WHERE username = ?;")
+	checkErr("Db error in UpdateUserPreferences()", errDb)
+
+	_, errDBexec := query.Exec(prefs.Temperature, prefs.WindSpeed, prefs.Pressure, prefs.Language, username)
+	checkErr("Db exec error in UpdateUserPreferences()", errDBexec)
+
+	query.Close()
+}
+
 // Verify the username is already registered by checking the database
 func CheckUsernameExists(username string) bool {
 	query, err := db.Query("SELECT username FROM users WHERE username = ?;", username)
@@ -139,6 +176,29 @@ func IsValidSessionKey(username string, key string) bool {
 	return validSession
 }
 
+// Retrieve the user a session key belongs to, an empty username is returned when the key is
+// unknown or expired. The JSON API accepts session keys as bearer tokens
+func GetSessionUser(key string) string {
+	query, err := db.Query("SELECT username, logintime FROM usersSession WHERE sessionkey = ?;", key)
+	checkErr("Db query error in GetSessionUser()", err)
+
+	var username string
+	var loginTime time.Time
+
+	for query.Next() {
+		err = query.Scan(&username, &loginTime)
+		checkErr("Query scan error GetSessionUser()", err)
+	}
+
+	query.Close()
+
+	// Same 6 hours limit as IsValidSessionKey()
+	if username == "" || time.Since(loginTime).Hours() > 6 {
+		return ""
+	}
+	return username
+}
+
 // Delete the entry from 'userSession' table based on the session key
 func DeleteSessionKey(key string) {
 	queryDelete, errDb := db.Prepare("DELETE FROM usersSession where sessionkey = ?")
@@ -232,34 +292,66 @@ func PrintSessionHistory(command string){
 	}
 }
 
-// The table 'city' was created by using the following JSON file and it contains all possible cities 
-// that the API supports: http://bulk.openweathermap.org/sample/city.list.json.gz
-// This function outputs JSON formatted string with region and id based on the search term.
-// It is called when the HTTP handler (CityHandler) receives a request via: "/citylist.json?search=".
+// The table 'city' is filled from the following JSON file by 'go run main.go importcities' and it
+// contains all possible cities that the API supports: http://bulk.openweathermap.org/sample/city.list.json.gz
+// This function returns the region and id of the cities for the search term, page by page and
+// optionally of one country, see CitySearchPage(). It is called when the HTTP handler (CityHandler)
+// receives a request via: "/citylist.json?search=".
 // The jQuery autocomplete library utlizes this to output region suggestions as the user enters value
-func CityQuery(searchTerm string) string {
-	query, err := db.Query("SELECT key, region FROM city WHERE LOWER(region) like '%%"+searchTerm+"%%' limit 5;")
-	checkErr("Db query error in CityQuery()", err)
+func CityQuery(searchTerm string, country string, limit int, offset int) []definition.CityOption {
+	var options []definition.CityOption
+
+	for _, city := range CitySearchPage(searchTerm, country, limit, offset) {
+		options = append(options, definition.CityOption{Value: city.Id, Label: city.Region, Suggestion: city.Suggestion})
+	}
+
+	return options
+}
+
+// Retrieve up to 5 cities for the search term, see CitySearchPage()
+func CitySearch(searchTerm string) []definition.City {
+	return CitySearchPage(searchTerm, "", 5, 0)
+}
+
+// Retrieve up to 'limit' cities for the search term after skipping the first 'offset', from the
+// in-memory prefix index ranked like searchCities() does in SQL. When fewer match, the rest are
+// "did you mean" suggestions for a misspelled term from suggestCities(). A country code (e.g. "CA")
+// keeps the cities of that country
+func CitySearchPage(searchTerm string, country string, limit int, offset int) []definition.City {
+	cities := getPrefixIndex().search(searchTerm, country, offset+limit)
+	cities = append(cities, suggestCities(searchTerm, country, offset+limit-len(cities), cities)...)
+	if offset >= len(cities) {
+		return nil
+	}
+	return cities[offset:]
+}
+
+// Retrieve the region name (e.g. "London, GB") of a city by its key, which is the OpenWeatherMap city id
+func GetCityRegion(key string) string {
+	query, err := db.Query("SELECT region FROM city WHERE key = ?;", key)
+	checkErr("Db query error in GetCityRegion()", err)
 
-	var key int
 	var region string
-	var output string
 
 	for query.Next() {
-		err = query.Scan(&key, &region)
-		checkErr("Query scan error in CityQuery()", err)
-		output += fmt.Sprintf("{\"value\":%d,\"label\":\"%s\"},",key,region)
+		err = query.Scan(&region)
+		checkErr("Query scan error in GetCityRegion()", err)
 	}
-
 	query.Close()
-	return output
+
+	return region
 }
 
 // "I’m feeling lucky button" feature utilizes this function to retrieve random city. For each user a random 
 // number is initially chosen from a range of total number of regions from the 'city' table. Last shown 
 // region key is stored in the 'luckyTracker' table based on the username. To avoid collision a double
-// hashing function is used
-func GetRandomCity(username string) string {
+// hashing function is used. ErrNoCities is returned while the 'city' table is empty
+func GetRandomCity(username string) (string, error) {
+	tableSize := getCityTableSize()
+	if tableSize == 0 {
+		return "", ErrNoCities
+	}
+
 	query, err := db.Query("SELECT lastshownkey FROM luckyTracker WHERE username = ?;", username)
 	checkErr("Db query error in GetRandomCity()", err)
 
@@ -278,9 +370,9 @@ func GetRandomCity(username string) string {
 	if !found {
 		// Assign a new starting point for each user using "I’m feeling lucky button" feature for the first time
 		rand.Seed(time.Now().Unix())
-		r = rand.Intn(209490-1) + 1 // Adding 1 as there is no city entry at 0 (referring to 'city' table)
+		r = rand.Intn(tableSize) + 1 // Adding 1 as there is no city entry at 0 (referring to 'city' table)
 	} else {
-		r = doubleHashing(lastshownkey)
+		r = doubleHashing(lastshownkey, tableSize)
 	}
 
 	if !found {
@@ -314,25 +406,51 @@ func GetRandomCity(username string) string {
 	}
 	query.Close()
 
-	return strconv.Itoa(cityKey)
+	return strconv.Itoa(cityKey), nil
 }
 
 // Utilize double hashing to avoid collision which will result in showing unique cities to user using 
-// 'Feeling Lucky' feature
-func doubleHashing(r int) int {
-	// 7 was chosen arbitrarily and also there is no common factor with total number of cities (209497) 
-	// which is relatively prime
+// 'Feeling Lucky' feature. The ids run from 1 to 'tableSize', a key from before a smaller import is
+// wrapped into that range too
+func doubleHashing(r int, tableSize int) int {
+	// Every city is shown once before any is shown again as long as the decrement has no common factor
+	// with the number of cities. 7 was chosen arbitrarily, the next number is taken when it does
 	decrement := 7
-	cityTableSize := 209497
-
-	r = r - decrement
+	for gcd(decrement, tableSize) != 1 {
+		decrement++
+	}
 
 	// To correct the index to wrap around the table
-	if r <= 0 {
-		r = r + cityTableSize
+	r = (r - 1 - decrement) % tableSize
+	if r < 0 {
+		r = r + tableSize
 	}
 
-	return r
+	return r + 1
+}
+
+func gcd(a int, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Read the largest id of the 'city' table, 0 when it is empty
+func loadCityTableSize() {
+	var tableSize sql.NullInt64
+	err := db.QueryRow("SELECT MAX(id) FROM city;").Scan(&tableSize)
+	checkErr("Db query error in loadCityTableSize()", err)
+
+	cityTableSizeMutex.Lock()
+	cityTableSize = int(tableSize.Int64)
+	cityTableSizeMutex.Unlock()
+}
+
+func getCityTableSize() int {
+	cityTableSizeMutex.Lock()
+	defer cityTableSizeMutex.Unlock()
+	return cityTableSize
 }
 
 func CloseDB() {
@@ -345,8 +463,19 @@ func checkErr(message string, err error) {
 	}
 }
 
-func init(){
+// Open the database at 'path', creating it when it is not there, and bring its schema up to date.
+// The server opens settings.DBFILE, the tests one in a temporary directory
+func OpenDB(path string) error {
 	var err error
-	db, err = sql.Open("sqlite3", "userdb.sqlite?cache=shared&mode=rwc")
-	checkErr("Sqlite3 open error", err)
+	db, err = sql.Open("sqlite3", path+"?cache=shared&mode=rwc")
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return err
+	}
+
+	migrate()
+	loadCityTableSize()
+	return nil
 }
\ No newline at end of file
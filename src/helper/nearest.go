@@ -0,0 +1,76 @@
+package helper
+
+import (
+	"definition"
+	"errors"
+	"geo"
+	"strconv"
+	"sync"
+)
+
+var (
+	cityIndex      *geo.Index
+	cityIndexMutex sync.Mutex
+)
+
+// Returned by NearestCity() while no city has coordinates. They come with OpenWeatherMap's city
+// list, see ImportCityList()
+var ErrNoCityCoordinates = errors.New("no city has coordinates yet, import the city list with 'go run main.go importcities'")
+
+// Find the city from the 'city' table closest to the coordinate by great-circle distance. The
+// spatial index is built from the table the first time it is needed
+func NearestCity(lat float64, lon float64) (definition.NearestCity, error) {
+	point, distance, found := getCityIndex().Nearest(lat, lon)
+	if !found {
+		return definition.NearestCity{}, ErrNoCityCoordinates
+	}
+
+	nearest := definition.NearestCity{
+		City:       definition.City{Id: point.Id, Lat: float32(point.Lat), Lon: float32(point.Lon)},
+		DistanceKm: float32(distance),
+	}
+	nearest.City.Region = GetCityRegion(strconv.Itoa(point.Id))
+	return nearest, nil
+}
+
+// Drop the spatial, prefix and fuzzy indexes so they are rebuilt with the current contents of the
+// 'city' table, and count its cities again for GetRandomCity()
+func ReloadCityIndex() {
+	loadCityTableSize()
+	cityIndexMutex.Lock()
+	cityIndex = nil
+	cityIndexMutex.Unlock()
+	reloadPrefixIndex()
+	reloadFuzzyIndex()
+}
+
+func getCityIndex() *geo.Index {
+	cityIndexMutex.Lock()
+	defer cityIndexMutex.Unlock()
+
+	if cityIndex == nil {
+		cityIndex = geo.NewIndex(loadCityPoints())
+	}
+	return cityIndex
+}
+
+// Cities without coordinates cannot be found by the nearest city lookup
+func loadCityPoints() []geo.Point {
+	query, err := db.Query("SELECT key, lat, lon FROM city WHERE lat IS NOT NULL AND lon IS NOT NULL;")
+	checkErr("Db query error in loadCityPoints()", err)
+	if err != nil {
+		return nil
+	}
+
+	var points []geo.Point
+
+	for query.Next() {
+		var point geo.Point
+		err = query.Scan(&point.Id, &point.Lat, &point.Lon)
+		checkErr("Query scan error in loadCityPoints()", err)
+		points = append(points, point)
+	}
+	query.Close()
+
+	return points
+}
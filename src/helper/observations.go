@@ -0,0 +1,97 @@
+package helper
+
+import (
+	"definition"
+)
+
+// Store a weather result in the 'observations' table. It has to be in metric units, as fetched from
+// the provider. The same observation is often fetched several times (e.g. by different users), only
+// the first one is kept. Results without a city id cannot be stored
+func SaveObservation(reqWeather definition.CurrentWeather) {
+	if reqWeather.CityId == 0 || reqWeather.Dt == 0 || reqWeather.Main == nil {
+		return
+	}
+
+	var lat, lon, windSpeed, windDeg, clouds, rain, snow float32
+	var conditionId int
+	var condition, description, icon, country string
+
+	if reqWeather.Coord != nil {
+		lat, lon = reqWeather.Coord.Lat, reqWeather.Coord.Lon
+	}
+	if reqWeather.Wind != nil {
+		windSpeed, windDeg = reqWeather.Wind.Speed, reqWeather.Wind.Deg
+	}
+	if reqWeather.Clouds != nil {
+		clouds = reqWeather.Clouds.All
+	}
+	if reqWeather.Rain != nil {
+		rain = reqWeather.Rain.RainVolume3H
+	}
+	if reqWeather.Snow != nil {
+		snow = reqWeather.Snow.SnowVolume3H
+	}
+	if len(reqWeather.Weather) > 0 {
+		weather := reqWeather.Weather[0]
+		conditionId, condition, description, icon = weather.Id, weather.Main, weather.Description, weather.Icon
+	}
+	if reqWeather.Sys != nil {
+		country = reqWeather.Sys.Country
+	}
+
+	_, err := db.Exec("INSERT OR IGNORE INTO observations (cityid, dt, name, country, lat, lon, temp, tempmin, tempmax, pressure, humidity, "+
+		"windspeed, winddeg, clouds, rain, snow, conditionid, condition, description, icon, provider, timezone) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);",
+		reqWeather.CityId, reqWeather.Dt, reqWeather.Name, country, lat, lon,
+		reqWeather.Main.Temp, reqWeather.Main.TempMin, reqWeather.Main.TempMax, reqWeather.Main.Pressure, reqWeather.Main.Humidity,
+		windSpeed, windDeg, clouds, rain, snow, conditionId, condition, description, icon, reqWeather.Provider, reqWeather.Timezone)
+	checkErr("Db exec error in SaveObservation()", err)
+}
+
+// Retrieve the observations of a city between two Unix times (both included), oldest first.
+// They are returned in the same shape as they were fetched, in metric units
+func GetObservations(cityId int, from int64, to int64) []definition.CurrentWeather {
+	query, err := db.Query("SELECT dt, name, country, lat, lon, temp, tempmin, tempmax, pressure, humidity, windspeed, winddeg, clouds, "+
+		"rain, snow, conditionid, condition, description, icon, provider, timezone FROM observations "+
+		"WHERE cityid = ? AND dt BETWEEN ? AND ? ORDER BY dt;", cityId, from, to)
+	checkErr("Db query error in GetObservations()", err)
+	if err != nil {
+		return nil
+	}
+
+	var observations []definition.CurrentWeather
+
+	for query.Next() {
+		reqWeather := definition.CurrentWeather{
+			CityId: cityId,
+			Code:   200,
+			Coord:  &definition.Coord{},
+			Main:   &definition.Main{},
+			Wind:   &definition.Wind{},
+			Clouds: &definition.Clouds{},
+			Sys:    &definition.Sys{},
+		}
+		var rain, snow float32
+		weather := &definition.Weather{}
+
+		err = query.Scan(&reqWeather.Dt, &reqWeather.Name, &reqWeather.Sys.Country, &reqWeather.Coord.Lat, &reqWeather.Coord.Lon,
+			&reqWeather.Main.Temp, &reqWeather.Main.TempMin, &reqWeather.Main.TempMax, &reqWeather.Main.Pressure, &reqWeather.Main.Humidity,
+			&reqWeather.Wind.Speed, &reqWeather.Wind.Deg, &reqWeather.Clouds.All, &rain, &snow,
+			&weather.Id, &weather.Main, &weather.Description, &weather.Icon, &reqWeather.Provider, &reqWeather.Timezone)
+		checkErr("Query scan error in GetObservations()", err)
+
+		if weather.Description != "" {
+			reqWeather.Weather = []*definition.Weather{weather}
+		}
+		if rain > 0 {
+			reqWeather.Rain = &definition.Rain{RainVolume3H: rain}
+		}
+		if snow > 0 {
+			reqWeather.Snow = &definition.Snow{SnowVolume3H: snow}
+		}
+		observations = append(observations, reqWeather)
+	}
+	query.Close()
+
+	return observations
+}
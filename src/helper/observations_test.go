@@ -0,0 +1,76 @@
+package helper
+
+import (
+	"definition"
+	"reflect"
+	"testing"
+)
+
+func testObservation(cityId int, dt int, temp float32) definition.CurrentWeather {
+	return definition.CurrentWeather{
+		CityId:   cityId,
+		Name:     "Toronto",
+		Dt:       dt,
+		Timezone: -4 * 3600,
+		Coord:    &definition.Coord{Lat: 43.7001, Lon: -79.4163},
+		Main:     &definition.Main{Temp: temp, TempMin: temp - 1, TempMax: temp + 1, Pressure: 1015, Humidity: 60},
+		Weather: []*definition.Weather{
+			{Id: 500, Main: "Rain", Description: "light rain", Icon: "10d"},
+		},
+		Rain: &definition.Rain{RainVolume3H: 0.5},
+	}
+}
+
+func TestObservations(t *testing.T) {
+	const toronto, ottawa = 6167865, 6094817
+	for _, cityId := range []int{toronto, ottawa} {
+		if _, err := db.Exec("DELETE FROM observations WHERE cityid = ?;", cityId); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	SaveObservation(testObservation(toronto, 1000, 10))
+	SaveObservation(testObservation(toronto, 2000, 20))
+	SaveObservation(testObservation(toronto, 3000, 30))
+	SaveObservation(testObservation(ottawa, 2000, 5))
+	// Fetched again, only the first one is kept
+	SaveObservation(testObservation(toronto, 2000, 99))
+	// Nothing to store
+	SaveObservation(definition.CurrentWeather{CityId: toronto, Dt: 4000})
+	SaveObservation(testObservation(0, 4000, 40))
+
+	tests := []struct {
+		cityId int
+		from   int64
+		to     int64
+		want   []float32
+	}{
+		// Both ends are included
+		{toronto, 1000, 3000, []float32{10, 20, 30}},
+		{toronto, 1000, 2000, []float32{10, 20}},
+		{toronto, 1001, 2999, []float32{20}},
+		{toronto, 3001, 5000, nil},
+		{ottawa, 0, 5000, []float32{5}},
+	}
+
+	for _, test := range tests {
+		var temps []float32
+		for _, observation := range GetObservations(test.cityId, test.from, test.to) {
+			temps = append(temps, observation.Main.Temp)
+		}
+		if !reflect.DeepEqual(temps, test.want) {
+			t.Errorf("GetObservations(%d, %d, %d) temperatures = %v, want %v", test.cityId, test.from, test.to, temps, test.want)
+		}
+	}
+
+	// Read back the way it was fetched
+	observations := GetObservations(toronto, 1000, 1000)
+	if len(observations) != 1 {
+		t.Fatalf("%d observations at 1000, want 1", len(observations))
+	}
+	got, want := observations[0], testObservation(toronto, 1000, 10)
+	if got.Name != want.Name || got.Timezone != want.Timezone || *got.Coord != *want.Coord || *got.Main != *want.Main || len(got.Weather) != 1 ||
+		*got.Weather[0] != *want.Weather[0] || got.Rain == nil || *got.Rain != *want.Rain || got.Snow != nil {
+		t.Errorf("GetObservations() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package helper
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Bring the database schema up to date. Tables that were added after the initial 'userdb.sqlite'
+// are created here, and new columns are added to the existing tables
+func migrate() {
+	// Unit preferences, the defaults match what the app always used (°C, m/s and hPa)
+	ensureColumn("users", "tempunit", "TEXT NOT NULL DEFAULT 'metric'")
+	ensureColumn("users", "windunit", "TEXT NOT NULL DEFAULT 'ms'")
+	ensureColumn("users", "pressureunit", "TEXT NOT NULL DEFAULT 'hpa'")
+	// An empty language means the browser's Accept-Language is used
+	ensureColumn("users", "language", "TEXT NOT NULL DEFAULT ''")
+
+	// Cities of OpenWeatherMap's city.list.json, filled by 'go run main.go importcities'. 'id' numbers
+	// the rows from 1 for the lucky feature, 'key' is the OpenWeatherMap city id
+	ensureTable("city", "id INTEGER PRIMARY KEY, key INTEGER, region TEXT")
+	ensureIndex("cityKey", "city", "key")
+
+	// Coordinates of the cities in OpenWeatherMap's city.list.json, for the nearest city lookup
+	ensureColumn("city", "lat", "REAL")
+	ensureColumn("city", "lon", "REAL")
+	// Name and country code on their own, 'region' combines them as in "London, GB"
+	ensureColumn("city", "name", "TEXT")
+	ensureColumn("city", "country", "TEXT")
+	// Full-text index and capitals for the city autocomplete
+	ensureCitySearch()
+
+	// Weather alerts per location, 'alertChecks' records until when the stored alerts are up to date
+	ensureTable("alertChecks", "location TEXT PRIMARY KEY, validuntil INTEGER NOT NULL")
+	ensureTable("weatherAlerts", "location TEXT NOT NULL, sender TEXT, event TEXT, severity TEXT, start INTEGER, end INTEGER, description TEXT")
+
+	// Every weather result that was fetched, in metric units. A city has one row per observation time
+	ensureTable("observations", "cityid INTEGER NOT NULL, dt INTEGER NOT NULL, name TEXT, country TEXT, lat REAL, lon REAL, "+
+		"temp REAL, tempmin REAL, tempmax REAL, pressure REAL, humidity REAL, windspeed REAL, winddeg REAL, clouds REAL, "+
+		"rain REAL, snow REAL, conditionid INTEGER, condition TEXT, description TEXT, icon TEXT, provider TEXT, "+
+		"PRIMARY KEY (cityid, dt)")
+	// UTC offset of the city in seconds, so the history charts show its local time
+	ensureColumn("observations", "timezone", "INTEGER NOT NULL DEFAULT 0")
+
+	// Calls made to each upstream API per day, to keep an eye on the quota of the shared API key
+	ensureTable("apiUsage", "provider TEXT NOT NULL, day TEXT NOT NULL, calls INTEGER NOT NULL DEFAULT 0, "+
+		"rejected INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (provider, day)")
+}
+
+func ensureTable(table string, columnDefs string) {
+	_, err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);", table, columnDefs))
+	checkErr("Db exec error in ensureTable()", err)
+}
+
+func ensureIndex(index string, table string, columns string) {
+	_, err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s);", index, table, columns))
+	checkErr("Db exec error in ensureIndex()", err)
+}
+
+// Add a column to an existing table unless it is already there. SQLite has no
+// 'ADD COLUMN IF NOT EXISTS', so the columns of the table are checked first
+func ensureColumn(table string, column string, columnDef string) {
+	query, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	checkErr("Db query error in ensureColumn()", err)
+	if err != nil {
+		return
+	}
+
+	tableExists := false
+	columnExists := false
+
+	var cid, notNull, primaryKey int
+	var name, columnType string
+	var defaultValue sql.NullString
+
+	for query.Next() {
+		err = query.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey)
+		checkErr("Query scan error in ensureColumn()", err)
+		tableExists = true
+		if name == column {
+			columnExists = true
+		}
+	}
+	query.Close()
+
+	if tableExists && !columnExists {
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, columnDef))
+		checkErr("Db exec error in ensureColumn()", err)
+	}
+}
@@ -0,0 +1,50 @@
+package helper
+
+import (
+	"definition"
+	"time"
+)
+
+// Count a call to an upstream API on today's (UTC) counters, or a call the quota did not allow
+func RecordApiUsage(provider string, allowed bool) {
+	day := time.Now().UTC().Format("2006-01-02")
+	column := "calls"
+	if !allowed {
+		column = "rejected"
+	}
+
+	_, err := db.Exec("INSERT OR IGNORE INTO apiUsage (provider, day) VALUES (?, ?);", provider, day)
+	checkErr("Db exec error in RecordApiUsage()", err)
+	_, err = db.Exec("UPDATE apiUsage SET "+column+" = "+column+" + 1 WHERE provider = ? AND day = ?;", provider, day)
+	checkErr("Db exec error in RecordApiUsage()", err)
+}
+
+// Number of calls made to an upstream API today (UTC)
+func GetApiCallsToday(provider string) int {
+	var calls int
+	day := time.Now().UTC().Format("2006-01-02")
+	db.QueryRow("SELECT calls FROM apiUsage WHERE provider = ? AND day = ?;", provider, day).Scan(&calls)
+	return calls
+}
+
+// Usage counters of the last 'days' days, newest first
+func GetApiUsage(days int) []definition.ApiUsage {
+	since := time.Now().UTC().AddDate(0, 0, 1-days).Format("2006-01-02")
+	query, err := db.Query("SELECT provider, day, calls, rejected FROM apiUsage WHERE day >= ? ORDER BY day DESC, provider;", since)
+	checkErr("Db query error in GetApiUsage()", err)
+	if err != nil {
+		return nil
+	}
+
+	var usage []definition.ApiUsage
+
+	for query.Next() {
+		var row definition.ApiUsage
+		err = query.Scan(&row.Provider, &row.Day, &row.Calls, &row.Rejected)
+		checkErr("Query scan error in GetApiUsage()", err)
+		usage = append(usage, row)
+	}
+	query.Close()
+
+	return usage
+}
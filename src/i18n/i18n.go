@@ -0,0 +1,122 @@
+package i18n
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Used when a message is missing from a catalog, or no language matches
+	DefaultLanguage = "en"
+)
+
+var (
+	// Message catalogs are JSON files named after the language code, e.g. 'locales/fr.json',
+	// relative to the server directory like the templates
+	CatalogDir = "locales"
+
+	catalogs    map[string]map[string]string
+	catalogOnce sync.Once
+)
+
+// Translate the message 'key' into the language 'lang'. The English message, or the key itself,
+// is returned when there is no translation
+func T(lang string, key string) string {
+	loadCatalogs()
+
+	if message, found := catalogs[lang][key]; found {
+		return message
+	}
+	if message, found := catalogs[DefaultLanguage][key]; found {
+		return message
+	}
+	return key
+}
+
+func Supported(lang string) bool {
+	loadCatalogs()
+	_, found := catalogs[lang]
+	return found
+}
+
+// Language codes that have a catalog, in alphabetical order
+func Languages() []string {
+	loadCatalogs()
+
+	var languages []string
+	for lang := range catalogs {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Pick the supported language the browser prefers most, based on an Accept-Language header such
+// as "fr-CA,fr;q=0.9,en;q=0.8". A language with "q=0" is not acceptable (RFC 9110 12.4.2), so it is
+// skipped like one whose weight cannot be read
+func FromAcceptLanguage(header string) string {
+	best := DefaultLanguage
+	bestQuality := 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.ToLower(strings.TrimSpace(fields[0]))
+		if i := strings.Index(lang, "-"); i >= 0 {
+			lang = lang[:i]
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		if quality > bestQuality && Supported(lang) {
+			best, bestQuality = lang, quality
+		}
+	}
+
+	return best
+}
+
+func loadCatalogs() {
+	catalogOnce.Do(func() {
+		catalogs = make(map[string]map[string]string)
+
+		files, err := filepath.Glob(filepath.Join(CatalogDir, "*.json"))
+		checkErr("Glob error in loadCatalogs()", err)
+
+		for _, file := range files {
+			content, err := ioutil.ReadFile(file)
+			checkErr("Read error in loadCatalogs()", err)
+
+			catalog := make(map[string]string)
+			err = json.Unmarshal(content, &catalog)
+			checkErr("JSON error in loadCatalogs() for "+file, err)
+			if err == nil {
+				catalogs[strings.TrimSuffix(filepath.Base(file), ".json")] = catalog
+			}
+		}
+	})
+}
+
+func checkErr(message string, err error) {
+	if err != nil {
+		log.Printf("%s> %s", message, err.Error())
+	}
+}
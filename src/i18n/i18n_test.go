@@ -0,0 +1,39 @@
+package i18n
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	CatalogDir = "../server/locales"
+	os.Exit(m.Run())
+}
+
+func TestFromAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"fr-CA,fr;q=0.9,en;q=0.8", "fr"},
+		{"en;q=0.5, de;q=0.8", "de"},
+		{"ES-es", "es"},
+		// Unsupported languages are passed over
+		{"it,de;q=0.1", "de"},
+		{"it,pt", "en"},
+		// "q=0" means not acceptable, even when nothing else matches
+		{"fr;q=0", "en"},
+		{"fr;q=0.0, it", "en"},
+		{"de;q=0,fr;q=0.001", "fr"},
+		// A weight that cannot be read is not taken for the default of 1
+		{"de;q=high", "en"},
+		{"de;q=high,fr;q=0.2", "fr"},
+	}
+
+	for _, test := range tests {
+		if lang := FromAcceptLanguage(test.header); lang != test.want {
+			t.Errorf("FromAcceptLanguage(%q) = %s, want %s", test.header, lang, test.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+// A Breaker stops calls to a failing service for a while. After 'threshold' failures in a row it
+// opens and calls fail fast for 'cooldown'. Then a single trial call is let through: if it succeeds
+// the breaker closes again, otherwise it stays open for another cooldown
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mutex    sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Whether a call may be made now. When it may not, the time the next trial is allowed is returned
+func (b *Breaker) Allow() (bool, time.Time) {
+	return b.allow(time.Now())
+}
+
+func (b *Breaker) allow(now time.Time) (bool, time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failures < b.threshold {
+		return true, time.Time{}
+	}
+	retryAt := b.openedAt.Add(b.cooldown)
+	if b.trial || now.Before(retryAt) {
+		return false, retryAt
+	}
+	b.trial = true
+	return true, time.Time{}
+}
+
+func (b *Breaker) Success() {
+	b.mutex.Lock()
+	b.failures, b.trial = 0, false
+	b.mutex.Unlock()
+}
+
+// The call let through by Allow() was not made after all
+func (b *Breaker) Release() {
+	b.mutex.Lock()
+	b.trial = false
+	b.mutex.Unlock()
+}
+
+func (b *Breaker) Failure() {
+	b.failure(time.Now())
+}
+
+func (b *Breaker) failure(now time.Time) {
+	b.mutex.Lock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt, b.trial = now, false
+	}
+	b.mutex.Unlock()
+}
+
+// Whether the breaker is open, i.e. calls are failing fast
+func (b *Breaker) Open() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.failures >= b.threshold
+}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"testing"
+	"time"
+)
+
+// Steps of a breaker with a threshold of 2 and a cooldown of a minute. It closes on the first
+// success, opens on the second failure in a row, lets a single trial through once the cooldown is
+// over and opens for another cooldown when the trial fails
+func TestBreaker(t *testing.T) {
+	start := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	type step struct {
+		at        time.Duration // Since 'start'
+		call      string        // "allow", "success", "failure" or "release"
+		wantAllow bool
+		wantOpen  bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"closed", []step{
+			{0, "failure", false, false},
+			{0, "allow", true, false},
+			{0, "success", false, false},
+			{0, "failure", false, false},
+			{0, "allow", true, false},
+		}},
+		{"opens", []step{
+			{0, "failure", false, false},
+			{0, "failure", false, true},
+			{0, "allow", false, true},
+			{59 * time.Second, "allow", false, true},
+		}},
+		{"trial succeeds", []step{
+			{0, "failure", false, false},
+			{0, "failure", false, true},
+			{time.Minute, "allow", true, true},
+			// Only one trial at a time
+			{time.Minute, "allow", false, true},
+			{time.Minute, "success", false, false},
+			{time.Minute, "allow", true, false},
+		}},
+		{"trial fails", []step{
+			{0, "failure", false, false},
+			{0, "failure", false, true},
+			{time.Minute, "allow", true, true},
+			{time.Minute, "failure", false, true},
+			{time.Minute + 59*time.Second, "allow", false, true},
+			{2 * time.Minute, "allow", true, true},
+		}},
+		{"trial released", []step{
+			{0, "failure", false, false},
+			{0, "failure", false, true},
+			{time.Minute, "allow", true, true},
+			{time.Minute, "release", false, true},
+			{time.Minute, "allow", true, true},
+		}},
+	}
+
+	for _, test := range tests {
+		b := NewBreaker(2, time.Minute)
+		for i, step := range test.steps {
+			now := start.Add(step.at)
+			switch step.call {
+			case "allow":
+				allowed, retryAt := b.allow(now)
+				if allowed != step.wantAllow {
+					t.Errorf("%s, step %d: allowed %v, want %v", test.name, i+1, allowed, step.wantAllow)
+				}
+				if !allowed && retryAt.Before(now) {
+					t.Errorf("%s, step %d: retry at %v, which has passed", test.name, i+1, retryAt)
+				}
+			case "success":
+				b.Success()
+			case "failure":
+				b.failure(now)
+			case "release":
+				b.Release()
+			}
+			if open := b.Open(); open != step.wantOpen {
+				t.Errorf("%s, step %d: open %v, want %v", test.name, i+1, open, step.wantOpen)
+			}
+		}
+	}
+}
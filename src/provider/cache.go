@@ -0,0 +1,501 @@
+package provider
+
+import (
+	"container/list"
+	"definition"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Most entries a Cache keeps, the names, coordinates and postal codes pointing at a city included.
+// Past that the entry stored longest ago is dropped
+const cacheMaxEntries = 1000
+
+// A Cache keeps current weather in memory, keyed by city id, units and language. An entry lives until the
+// observation time 'Dt' plus the TTL, since the upstream data does not change before the next
+// observation. Concurrent misses for the same key share a single upstream request.
+// Expired entries are kept for a while longer: when the lookup fails upstream, e.g. the API quota is
+// used up or every provider of a Chain is down, the last answer is better than none, so it is
+// returned with 'Stale' set. Forecasts and air quality can be kept in the same entries, see
+// Forecasts() and AirQuality()
+type Cache struct {
+	provider WeatherProvider
+	ttl      time.Duration
+	staleFor time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	// The entries, stored longest ago first
+	order    *list.List
+	inFlight map[string]*cacheCall
+
+	hits      uint64
+	misses    uint64
+	coalesced uint64
+	stale     uint64
+}
+
+// Lookups answered from the cache, lookups that went upstream, lookups that waited for the same
+// one of another caller, and stale answers given instead
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Coalesced uint64
+	Stale     uint64
+	Entries   int
+}
+
+// What a Cache keeps: current weather, a forecast or air quality
+type cacheValue interface {
+	// OpenWeatherMap id of the city the value is about, 0 when it is not known
+	cityID() int
+	// Time the value was observed upstream, zero when it was not reported
+	observedAt() time.Time
+	// The handlers modify the result, so every caller gets its own copy of the nested structs
+	copy(stale bool) cacheValue
+}
+
+type cacheEntry struct {
+	key       string
+	value     cacheValue
+	expiresAt time.Time
+	// Set for a name, coordinate or postal code lookup, to the city id key its answer was cached under
+	cityKey string
+}
+
+type cacheCall struct {
+	done  sync.WaitGroup
+	value cacheValue
+	err   error
+}
+
+// Expired entries are kept for 'staleFor' after they expire, to fall back on when a lookup fails
+func NewCache(provider WeatherProvider, ttl time.Duration, staleFor time.Duration) *Cache {
+	return &Cache{
+		provider: provider,
+		ttl:      ttl,
+		staleFor: staleFor,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		inFlight: make(map[string]*cacheCall),
+	}
+}
+
+func (c *Cache) ByCityID(id string, opts Options) (definition.CurrentWeather, error) {
+	value, err := c.lookupByID("", id, opts, func() (cacheValue, error) {
+		reqWeather, err := c.provider.ByCityID(id, opts)
+		return cachedWeather(reqWeather), err
+	})
+	return weatherOf(value), err
+}
+
+// Name, coordinate and postal code lookups always go upstream, but the answer is cached under its city id
+func (c *Cache) ByName(name string, opts Options) (definition.CurrentWeather, error) {
+	value, err := c.fetch("", "q:"+strings.ToLower(name), false, opts, func() (cacheValue, error) {
+		reqWeather, err := c.provider.ByName(name, opts)
+		return cachedWeather(reqWeather), err
+	})
+	return weatherOf(value), err
+}
+
+func (c *Cache) ByCoord(lat float32, lon float32, opts Options) (definition.CurrentWeather, error) {
+	value, err := c.fetch("", "coord:"+coordKey(lat, lon), false, opts, func() (cacheValue, error) {
+		reqWeather, err := c.provider.ByCoord(lat, lon, opts)
+		return cachedWeather(reqWeather), err
+	})
+	return weatherOf(value), err
+}
+
+func (c *Cache) ByZip(zip string, country string, opts Options) (definition.CurrentWeather, error) {
+	value, err := c.fetch("", "zip:"+zip+","+country, false, opts, func() (cacheValue, error) {
+		reqWeather, err := c.provider.ByZip(zip, country, opts)
+		return cachedWeather(reqWeather), err
+	})
+	return weatherOf(value), err
+}
+
+// A ForecastProvider that keeps the forecasts of 'p' in this cache, the same way as the current
+// weather. A forecast lives for the TTL from when it was fetched
+func (c *Cache) Forecasts(p ForecastProvider) ForecastProvider {
+	return &forecastCache{cache: c, provider: p}
+}
+
+// An AirQualityProvider that keeps the air quality of 'p' in this cache by coordinate, until its
+// observation time plus the TTL
+func (c *Cache) AirQuality(p AirQualityProvider) AirQualityProvider {
+	return &airQualityCache{cache: c, provider: p}
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	entries := len(c.entries)
+	c.mutex.Unlock()
+
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Coalesced: atomic.LoadUint64(&c.coalesced),
+		Stale:     atomic.LoadUint64(&c.stale),
+		Entries:   entries,
+	}
+}
+
+// The kinds of values are kept apart by a prefix of their keys, "" for current weather
+func cacheKey(kind string, id string, opts Options) string {
+	return kind + id + "|" + opts.Units + "|" + opts.Lang
+}
+
+func coordKey(lat float32, lon float32) string {
+	return strconv.FormatFloat(float64(lat), 'f', 4, 32) + "," + strconv.FormatFloat(float64(lon), 'f', 4, 32)
+}
+
+// A lookup by city id is answered from the cache until the entry expires
+func (c *Cache) lookupByID(kind string, id string, opts Options, lookup func() (cacheValue, error)) (cacheValue, error) {
+	if value, found := c.get(cacheKey(kind, id, opts)); found {
+		return value, nil
+	}
+	return c.fetch(kind, id, true, opts, lookup)
+}
+
+func (c *Cache) get(key string) (cacheValue, bool) {
+	c.mutex.Lock()
+	var entry *cacheEntry
+	if element, found := c.entries[key]; found {
+		entry = element.Value.(*cacheEntry)
+	}
+	c.mutex.Unlock()
+
+	if entry == nil || entry.cityKey != "" || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return entry.value.copy(false), true
+}
+
+// Only the first caller for a key runs the lookup, everyone else arriving meanwhile waits for
+// its result. A successful result is cached under its city id, and also under 'key' if 'keep'
+// is set
+func (c *Cache) fetch(kind string, id string, keep bool, opts Options, lookup func() (cacheValue, error)) (cacheValue, error) {
+	key := cacheKey(kind, id, opts)
+
+	c.mutex.Lock()
+	if call, found := c.inFlight[key]; found {
+		c.mutex.Unlock()
+		call.done.Wait()
+		atomic.AddUint64(&c.coalesced, 1)
+		return call.value.copy(false), call.err
+	}
+	call := &cacheCall{}
+	call.done.Add(1)
+	c.inFlight[key] = call
+	c.mutex.Unlock()
+
+	atomic.AddUint64(&c.misses, 1)
+	call.value, call.err = lookup()
+
+	c.mutex.Lock()
+	delete(c.inFlight, key)
+	if call.err == nil {
+		if keep {
+			c.put(key, call.value)
+		}
+		if cityID := call.value.cityID(); cityID != 0 {
+			cityKey := cacheKey(kind, strconv.Itoa(cityID), opts)
+			c.put(cityKey, call.value)
+			if !keep {
+				c.store(&cacheEntry{key: key, cityKey: cityKey})
+			}
+		}
+	} else if !isNotFound(call.err) {
+		if value, found := c.staleEntry(key); found {
+			call.value, call.err = value, nil
+			atomic.AddUint64(&c.stale, 1)
+		}
+	}
+	c.mutex.Unlock()
+	call.done.Done()
+
+	return call.value.copy(false), call.err
+}
+
+// A location the provider does not know is an answer, so only the other errors fall back on a stale entry
+func isNotFound(err error) bool {
+	var apiError *Error
+	return err == ErrNotFound || (errors.As(err, &apiError) && apiError.Code == http.StatusNotFound)
+}
+
+// Must be called with the mutex held. The entry for 'key', or the one its lookup was last answered
+// with, even if it expired
+func (c *Cache) staleEntry(key string) (cacheValue, bool) {
+	element, found := c.entries[key]
+	if found && element.Value.(*cacheEntry).cityKey != "" {
+		element, found = c.entries[element.Value.(*cacheEntry).cityKey]
+	}
+	if !found {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if entry.cityKey != "" || time.Now().After(entry.expiresAt.Add(c.staleFor)) {
+		return nil, false
+	}
+
+	return entry.value.copy(true), true
+}
+
+// Must be called with the mutex held. A provider can report an old observation, so every entry
+// is kept for at least a tenth of the TTL to avoid asking again straight away. A value without an
+// observation time is kept for the TTL
+func (c *Cache) put(key string, value cacheValue) {
+	now := time.Now()
+	expiresAt := now.Add(c.ttl)
+	if observedAt := value.observedAt(); !observedAt.IsZero() {
+		expiresAt = observedAt.Add(c.ttl)
+	}
+	if minimum := now.Add(c.ttl / 10); expiresAt.Before(minimum) {
+		expiresAt = minimum
+	} else if maximum := now.Add(c.ttl); expiresAt.After(maximum) {
+		expiresAt = maximum
+	}
+
+	c.store(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+}
+
+// Must be called with the mutex held. A stored entry counts as new again, and the entries stored
+// longest ago are dropped past cacheMaxEntries. They are about the first to expire, as every entry
+// lives for at most the TTL. A name whose city was dropped is left to be dropped in turn
+func (c *Cache) store(entry *cacheEntry) {
+	if element, found := c.entries[entry.key]; found {
+		element.Value = entry
+		c.order.MoveToBack(element)
+		return
+	}
+
+	c.entries[entry.key] = c.order.PushBack(entry)
+	for c.order.Len() > cacheMaxEntries {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Current weather as kept by the Cache. The observation time is 'Dt', which the providers always set
+type cachedWeather definition.CurrentWeather
+
+func (w cachedWeather) cityID() int {
+	return w.CityId
+}
+
+func (w cachedWeather) observedAt() time.Time {
+	return time.Unix(int64(w.Dt), 0)
+}
+
+func (w cachedWeather) copy(stale bool) cacheValue {
+	copied := copyWeather(definition.CurrentWeather(w))
+	if stale {
+		copied.Stale = true
+	}
+	return cachedWeather(copied)
+}
+
+func weatherOf(value cacheValue) definition.CurrentWeather {
+	reqWeather, _ := value.(cachedWeather)
+	return definition.CurrentWeather(reqWeather)
+}
+
+func copyWeather(reqWeather definition.CurrentWeather) definition.CurrentWeather {
+	copied := reqWeather
+	if reqWeather.Coord != nil {
+		coord := *reqWeather.Coord
+		copied.Coord = &coord
+	}
+	if reqWeather.Weather != nil {
+		copied.Weather = copyConditions(reqWeather.Weather)
+	}
+	if reqWeather.Main != nil {
+		main := *reqWeather.Main
+		copied.Main = &main
+	}
+	if reqWeather.Wind != nil {
+		wind := *reqWeather.Wind
+		copied.Wind = &wind
+	}
+	if reqWeather.Clouds != nil {
+		clouds := *reqWeather.Clouds
+		copied.Clouds = &clouds
+	}
+	if reqWeather.Rain != nil {
+		rain := *reqWeather.Rain
+		copied.Rain = &rain
+	}
+	if reqWeather.Snow != nil {
+		snow := *reqWeather.Snow
+		copied.Snow = &snow
+	}
+	if reqWeather.Sys != nil {
+		sys := *reqWeather.Sys
+		copied.Sys = &sys
+	}
+	return copied
+}
+
+func copyConditions(conditions []*definition.Weather) []*definition.Weather {
+	copied := make([]*definition.Weather, len(conditions))
+	for i, weather := range conditions {
+		w := *weather
+		copied[i] = &w
+	}
+	return copied
+}
+
+// Forecasts of a ForecastProvider kept by a Cache, looked up like its current weather
+type forecastCache struct {
+	cache    *Cache
+	provider ForecastProvider
+}
+
+func (f *forecastCache) ForecastByCityID(id string, opts Options) (definition.Forecast, error) {
+	value, err := f.cache.lookupByID("forecast:", id, opts, func() (cacheValue, error) {
+		forecast, err := f.provider.ForecastByCityID(id, opts)
+		return cachedForecast(forecast), err
+	})
+	return forecastOf(value), err
+}
+
+func (f *forecastCache) ForecastByName(name string, opts Options) (definition.Forecast, error) {
+	value, err := f.cache.fetch("forecast:", "q:"+strings.ToLower(name), false, opts, func() (cacheValue, error) {
+		forecast, err := f.provider.ForecastByName(name, opts)
+		return cachedForecast(forecast), err
+	})
+	return forecastOf(value), err
+}
+
+func (f *forecastCache) ForecastByCoord(lat float32, lon float32, opts Options) (definition.Forecast, error) {
+	value, err := f.cache.fetch("forecast:", "coord:"+coordKey(lat, lon), false, opts, func() (cacheValue, error) {
+		forecast, err := f.provider.ForecastByCoord(lat, lon, opts)
+		return cachedForecast(forecast), err
+	})
+	return forecastOf(value), err
+}
+
+func (f *forecastCache) ForecastByZip(zip string, country string, opts Options) (definition.Forecast, error) {
+	value, err := f.cache.fetch("forecast:", "zip:"+zip+","+country, false, opts, func() (cacheValue, error) {
+		forecast, err := f.provider.ForecastByZip(zip, country, opts)
+		return cachedForecast(forecast), err
+	})
+	return forecastOf(value), err
+}
+
+// A forecast has no observation time, it lives for the TTL from when it was fetched
+type cachedForecast definition.Forecast
+
+func (f cachedForecast) cityID() int {
+	if f.City == nil {
+		return 0
+	}
+	return f.City.Id
+}
+
+func (f cachedForecast) observedAt() time.Time {
+	return time.Time{}
+}
+
+func (f cachedForecast) copy(stale bool) cacheValue {
+	copied := f
+	if f.City != nil {
+		city := *f.City
+		if city.Coord != nil {
+			coord := *city.Coord
+			city.Coord = &coord
+		}
+		copied.City = &city
+	}
+	if f.List != nil {
+		copied.List = make([]*definition.ForecastItem, len(f.List))
+		for i, item := range f.List {
+			copied.List[i] = copyForecastItem(item)
+		}
+	}
+	if stale {
+		copied.Stale = true
+	}
+	return copied
+}
+
+func copyForecastItem(item *definition.ForecastItem) *definition.ForecastItem {
+	copied := *item
+	if item.Main != nil {
+		main := *item.Main
+		copied.Main = &main
+	}
+	if item.Weather != nil {
+		copied.Weather = copyConditions(item.Weather)
+	}
+	if item.Clouds != nil {
+		clouds := *item.Clouds
+		copied.Clouds = &clouds
+	}
+	if item.Wind != nil {
+		wind := *item.Wind
+		copied.Wind = &wind
+	}
+	if item.Rain != nil {
+		rain := *item.Rain
+		copied.Rain = &rain
+	}
+	if item.Snow != nil {
+		snow := *item.Snow
+		copied.Snow = &snow
+	}
+	return &copied
+}
+
+func forecastOf(value cacheValue) definition.Forecast {
+	forecast, _ := value.(cachedForecast)
+	return definition.Forecast(forecast)
+}
+
+// Air quality of an AirQualityProvider kept by a Cache. It is not about a city and comes in one
+// language and unit, so it is keyed by the coordinate alone
+type airQualityCache struct {
+	cache    *Cache
+	provider AirQualityProvider
+}
+
+func (a *airQualityCache) AirQuality(lat float32, lon float32) (definition.AirQuality, error) {
+	value, err := a.cache.lookupByID("air:", coordKey(lat, lon), Options{}, func() (cacheValue, error) {
+		airQuality, err := a.provider.AirQuality(lat, lon)
+		return cachedAirQuality(airQuality), err
+	})
+	airQuality, _ := value.(cachedAirQuality)
+	return definition.AirQuality(airQuality), err
+}
+
+type cachedAirQuality definition.AirQuality
+
+func (a cachedAirQuality) cityID() int {
+	return 0
+}
+
+func (a cachedAirQuality) observedAt() time.Time {
+	if a.Dt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(a.Dt), 0)
+}
+
+func (a cachedAirQuality) copy(stale bool) cacheValue {
+	copied := a
+	if a.Components != nil {
+		components := *a.Components
+		copied.Components = &components
+	}
+	if stale {
+		copied.Stale = true
+	}
+	return copied
+}
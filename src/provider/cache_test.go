@@ -0,0 +1,195 @@
+package provider
+
+import (
+	"context"
+	"definition"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Answers every lookup with 'weather' or 'err', after 'release' is closed when it is set
+type fakeProvider struct {
+	weather definition.CurrentWeather
+	err     error
+	release chan struct{}
+	calls   int32
+}
+
+func (f *fakeProvider) lookup() (definition.CurrentWeather, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.release != nil {
+		<-f.release
+	}
+	return f.weather, f.err
+}
+
+func (f *fakeProvider) ByCityID(id string, opts Options) (definition.CurrentWeather, error) {
+	return f.lookup()
+}
+
+func (f *fakeProvider) ByName(name string, opts Options) (definition.CurrentWeather, error) {
+	return f.lookup()
+}
+
+func (f *fakeProvider) ByCoord(lat float32, lon float32, opts Options) (definition.CurrentWeather, error) {
+	return f.lookup()
+}
+
+func (f *fakeProvider) ByZip(zip string, country string, opts Options) (definition.CurrentWeather, error) {
+	return f.lookup()
+}
+
+// Once the entry expired, any failure but an unknown location is answered with it
+func TestCacheStaleFallback(t *testing.T) {
+	tests := []struct {
+		err       error
+		wantStale bool
+	}{
+		{ErrQuotaExceeded, true},
+		{&TimeoutError{Provider: "OpenWeatherMap", Err: context.DeadlineExceeded}, true},
+		{&UnavailableError{Provider: "OpenWeatherMap", Status: 502}, true},
+		// What a Chain returns when the fallback provider fails after the first one
+		{&Error{Code: 503, Message: "Service unavailable"}, true},
+		{ErrNotFound, false},
+		{&Error{Code: 404, Message: "city not found"}, false},
+	}
+
+	for _, test := range tests {
+		fake := &fakeProvider{weather: definition.CurrentWeather{CityId: 6167865, Name: "Toronto"}}
+		// An observation from 1970 expires after a tenth of the TTL
+		cache := NewCache(fake, 10*time.Millisecond, time.Hour)
+		if _, err := cache.ByName("Toronto", Options{}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		fake.err = test.err
+		reqWeather, err := cache.ByName("Toronto", Options{})
+		if stale := err == nil && reqWeather.Stale && reqWeather.Name == "Toronto"; stale != test.wantStale {
+			t.Errorf("%T: %+v, %v, want a stale answer: %v", test.err, reqWeather, err, test.wantStale)
+		}
+		if err != nil && err != test.err {
+			t.Errorf("%T: the error is %v", test.err, err)
+		}
+	}
+}
+
+// Callers waiting for the lookup of another one are neither hits nor misses
+func TestCacheCoalesced(t *testing.T) {
+	fake := &fakeProvider{weather: definition.CurrentWeather{CityId: 6167865, Name: "Toronto"}, release: make(chan struct{})}
+	cache := NewCache(fake, time.Hour, time.Hour)
+
+	var callers sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		callers.Add(1)
+		go func() {
+			defer callers.Done()
+			if reqWeather, err := cache.ByName("Toronto", Options{}); err != nil || reqWeather.Name != "Toronto" {
+				t.Errorf("%+v, %v", reqWeather, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(fake.release)
+	callers.Wait()
+
+	// Names always go upstream, so a caller after the lookup is another miss
+	stats := cache.Stats()
+	calls := uint64(atomic.LoadInt32(&fake.calls))
+	if stats.Hits != 0 || stats.Misses != calls || stats.Coalesced != 3-calls {
+		t.Errorf("stats = %+v after %d upstream lookups, want the other callers coalesced", stats, calls)
+	}
+}
+
+// Past cacheMaxEntries the entries stored longest ago make room, whether they expired or not
+func TestCacheMaxEntries(t *testing.T) {
+	fake := &fakeProvider{}
+	cache := NewCache(fake, time.Hour, time.Hour)
+
+	for i := 0; i < cacheMaxEntries+10; i++ {
+		if _, err := cache.ByCityID(strconv.Itoa(i), Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries := cache.Stats().Entries; entries != cacheMaxEntries {
+		t.Errorf("%d entries, want %d", entries, cacheMaxEntries)
+	}
+
+	calls := atomic.LoadInt32(&fake.calls)
+	cache.ByCityID(strconv.Itoa(cacheMaxEntries+9), Options{})
+	if atomic.LoadInt32(&fake.calls) != calls {
+		t.Errorf("the last city stored was dropped")
+	}
+	cache.ByCityID("0", Options{})
+	if atomic.LoadInt32(&fake.calls) != calls+1 {
+		t.Errorf("the first city stored was kept")
+	}
+}
+
+// Answers every forecast and air quality lookup with 'forecast', 'airQuality' or 'err'
+type fakeForecastProvider struct {
+	forecast   definition.Forecast
+	airQuality definition.AirQuality
+	err        error
+}
+
+func (f *fakeForecastProvider) ForecastByCityID(id string, opts Options) (definition.Forecast, error) {
+	return f.forecast, f.err
+}
+
+func (f *fakeForecastProvider) ForecastByName(name string, opts Options) (definition.Forecast, error) {
+	return f.forecast, f.err
+}
+
+func (f *fakeForecastProvider) ForecastByCoord(lat float32, lon float32, opts Options) (definition.Forecast, error) {
+	return f.forecast, f.err
+}
+
+func (f *fakeForecastProvider) ForecastByZip(zip string, country string, opts Options) (definition.Forecast, error) {
+	return f.forecast, f.err
+}
+
+func (f *fakeForecastProvider) AirQuality(lat float32, lon float32) (definition.AirQuality, error) {
+	return f.airQuality, f.err
+}
+
+// Forecasts and air quality fall back on their expired entries like the current weather does, and
+// are kept apart from it
+func TestCacheForecastAndAirQualityStale(t *testing.T) {
+	fake := &fakeForecastProvider{
+		forecast: definition.Forecast{City: &definition.ForecastCity{Id: 6167865, Name: "Toronto"},
+			List: []*definition.ForecastItem{{Dt: 1697446800, Main: &definition.Main{Temp: 12}}}},
+		airQuality: definition.AirQuality{Aqi: 2},
+	}
+	cache := NewCache(&fakeProvider{err: ErrQuotaExceeded}, 10*time.Millisecond, time.Hour)
+	forecasts, airQuality := cache.Forecasts(fake), cache.AirQuality(fake)
+
+	forecast, err := forecasts.ForecastByName("Toronto", Options{})
+	if err != nil || forecast.Stale {
+		t.Fatalf("%+v, %v", forecast, err)
+	}
+	// Every caller gets its own copy to convert
+	forecast.List[0].Main.Temp = 54
+	if _, err = airQuality.AirQuality(43.7, -79.4); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	fake.err = ErrQuotaExceeded
+	forecast, err = forecasts.ForecastByName("Toronto", Options{})
+	if err != nil || !forecast.Stale || forecast.List[0].Main.Temp != 12 {
+		t.Errorf("forecast: %+v, %v, want a stale answer of 12°", forecast, err)
+	}
+	if forecast, err = forecasts.ForecastByCityID("6167865", Options{Lang: "fr"}); err != ErrQuotaExceeded {
+		t.Errorf("forecast in another language: %+v, %v, want %v", forecast, err, ErrQuotaExceeded)
+	}
+	if reqAirQuality, err := airQuality.AirQuality(43.7, -79.4); err != nil || !reqAirQuality.Stale || reqAirQuality.Aqi != 2 {
+		t.Errorf("air quality: %+v, %v, want a stale answer", reqAirQuality, err)
+	}
+	if reqWeather, err := cache.ByCityID("6167865", Options{}); err != ErrQuotaExceeded {
+		t.Errorf("current weather: %+v, %v, want %v", reqWeather, err, ErrQuotaExceeded)
+	}
+}
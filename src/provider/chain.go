@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"definition"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// A Chain asks each provider in order and returns the first answer, so a slow or broken weather
+// service falls back to the next one. The answering provider is recorded in 'Provider'
+type Chain struct {
+	providers []WeatherProvider
+}
+
+func NewChain(providers ...WeatherProvider) *Chain {
+	return &Chain{providers: providers}
+}
+
+func (c *Chain) ByCityID(id string, opts Options) (definition.CurrentWeather, error) {
+	return c.first(func(p WeatherProvider) (definition.CurrentWeather, error) {
+		return p.ByCityID(id, opts)
+	})
+}
+
+func (c *Chain) ByName(name string, opts Options) (definition.CurrentWeather, error) {
+	return c.first(func(p WeatherProvider) (definition.CurrentWeather, error) {
+		return p.ByName(name, opts)
+	})
+}
+
+func (c *Chain) ByCoord(lat float32, lon float32, opts Options) (definition.CurrentWeather, error) {
+	return c.first(func(p WeatherProvider) (definition.CurrentWeather, error) {
+		return p.ByCoord(lat, lon, opts)
+	})
+}
+
+func (c *Chain) ByZip(zip string, country string, opts Options) (definition.CurrentWeather, error) {
+	return c.first(func(p WeatherProvider) (definition.CurrentWeather, error) {
+		return p.ByZip(zip, country, opts)
+	})
+}
+
+// When every provider fails, an answer about the location itself (not found or a bad request) is
+// more useful to the user than a connection error, so that error is preferred. A provider that
+// refused the call (e.g. a bad key) says nothing about the location or about why the others
+// failed, so its error comes last
+func (c *Chain) first(lookup func(WeatherProvider) (definition.CurrentWeather, error)) (definition.CurrentWeather, error) {
+	var reqWeather definition.CurrentWeather
+	var firstErr, locationErr, serviceErr error
+
+	for i, p := range c.providers {
+		var err error
+		reqWeather, err = lookup(p)
+		if err == nil {
+			if i > 0 {
+				log.Printf("Weather provider chain: answered by fallback '%s'", reqWeather.Provider)
+			}
+			return reqWeather, nil
+		}
+
+		log.Printf("Weather provider chain: provider %d failed> %s", i, err.Error())
+		if firstErr == nil {
+			firstErr = err
+		}
+		if isLocationError(err) {
+			if locationErr == nil {
+				locationErr = err
+			}
+		} else if serviceErr == nil && !isRefused(err) {
+			serviceErr = err
+		}
+	}
+
+	if locationErr != nil {
+		return reqWeather, locationErr
+	} else if serviceErr != nil {
+		return reqWeather, serviceErr
+	}
+	if firstErr == nil {
+		firstErr = ErrNotFound
+	}
+	return reqWeather, firstErr
+}
+
+// The location is unknown to the provider or it could not make sense of it
+func isLocationError(err error) bool {
+	var apiError *Error
+	return err == ErrNotFound || (errors.As(err, &apiError) &&
+		(apiError.Code == http.StatusBadRequest || apiError.Code == http.StatusNotFound))
+}
+
+func isRefused(err error) bool {
+	var apiError *Error
+	return errors.As(err, &apiError) && apiError.Refused()
+}
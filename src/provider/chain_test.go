@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"context"
+	"definition"
+	"testing"
+)
+
+// Which error the chain returns when both providers fail
+func TestChainError(t *testing.T) {
+	timeout := &TimeoutError{Provider: "Open-Meteo", Err: context.DeadlineExceeded}
+	unavailable := &UnavailableError{Provider: "Open-Meteo", Status: 502}
+	badRequest := &Error{Code: 400, Message: "Nothing to geocode"}
+	badKey := &Error{Code: 401, Message: "Invalid API key"}
+	rateLimited := &Error{Code: 429, Message: "Too many requests"}
+	forbidden := &Error{Code: 403, Message: "Forbidden"}
+
+	tests := []struct {
+		name              string
+		primary, fallback error
+		want              error
+	}{
+		{"location before service", timeout, ErrNotFound, ErrNotFound},
+		{"bad request before service", unavailable, badRequest, badRequest},
+		{"first location error", ErrNotFound, badRequest, ErrNotFound},
+		{"first service error", ErrQuotaExceeded, timeout, ErrQuotaExceeded},
+		{"bad key after timeout", badKey, timeout, timeout},
+		{"rate limited after unavailable", rateLimited, unavailable, unavailable},
+		{"bad key after location", badKey, ErrNotFound, ErrNotFound},
+		{"only refusals", forbidden, rateLimited, forbidden},
+	}
+
+	for _, test := range tests {
+		chain := NewChain(&fakeProvider{err: test.primary}, &fakeProvider{err: test.fallback})
+		if _, err := chain.ByName("Toronto", Options{}); err != test.want {
+			t.Errorf("%s: %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestChainFallback(t *testing.T) {
+	fallback := &fakeProvider{weather: definition.CurrentWeather{Name: "Toronto", Provider: "Open-Meteo"}}
+	chain := NewChain(&fakeProvider{err: &Error{Code: 401, Message: "Invalid API key"}}, fallback)
+
+	reqWeather, err := chain.ByName("Toronto", Options{})
+	if err != nil || reqWeather.Provider != "Open-Meteo" {
+		t.Errorf("%+v, %v, want the fallback's answer", reqWeather, err)
+	}
+}
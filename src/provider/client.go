@@ -0,0 +1,142 @@
+package provider
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// Each attempt gets this long, and a failing call is attempted this many times in total
+	clientTimeout  = 5 * time.Second
+	clientAttempts = 3
+	// The wait before retry n is random between 0 and retryBackoff * 2^n, at most retryMaxBackoff
+	retryBackoff    = 200 * time.Millisecond
+	retryMaxBackoff = 2 * time.Second
+	// The circuit opens after this many failed calls in a row and stays open for the cooldown
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// All providers share one transport, so connections to the APIs are kept alive and reused
+var sharedTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   clientTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   10,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   clientTimeout,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// A Client makes the GET requests of a provider. Timeouts, connection errors and server errors
+// (5xx) are retried with jittered exponential backoff, and when calls keep failing the circuit
+// breaker makes them fail fast with *CircuitOpenError until the service has had time to recover
+type Client struct {
+	provider string
+	http     *http.Client
+	breaker  *Breaker
+	quota    *Quota
+	// Waits between the attempts, time.Sleep but for the tests
+	sleep func(time.Duration)
+}
+
+// 'provider' names the service in errors, e.g. "OpenWeatherMap"
+func NewClient(provider string) *Client {
+	return &Client{
+		provider: provider,
+		http:     &http.Client{Transport: switchTransport{}, Timeout: clientTimeout},
+		breaker:  NewBreaker(breakerThreshold, breakerCooldown),
+		sleep:    time.Sleep,
+	}
+}
+
+// Every attempt, retries included, takes a token from 'quota'
+func (c *Client) SetQuota(quota *Quota) {
+	c.quota = quota
+}
+
+// Get 'apiUrl' and return the status and body of the response. Any response other than a server
+// error is returned as is, the caller decides what a 4xx means. Otherwise the error is a
+// *TimeoutError, *UnavailableError, *CircuitOpenError or ErrQuotaExceeded.
+// Replayed responses do not call the service, so they are not counted by the quota or the breaker,
+// and are not retried. A missing fixture is returned as a *FixtureMissingError
+func (c *Client) Get(apiUrl string) (int, []byte, error) {
+	if replaying() {
+		return c.attempt(apiUrl)
+	}
+
+	if allowed, retryAt := c.breaker.Allow(); !allowed {
+		return 0, nil, &CircuitOpenError{Provider: c.provider, RetryAt: retryAt}
+	}
+
+	var err error
+	for attempt := 0; attempt < clientAttempts; attempt++ {
+		if attempt > 0 {
+			c.sleep(backoff(attempt))
+		}
+		if quotaErr := c.quota.Take(); quotaErr != nil {
+			if err == nil {
+				// Nothing was attempted, which says nothing about the health of the service
+				c.breaker.Release()
+				return 0, nil, quotaErr
+			}
+			break
+		}
+
+		var status int
+		var body []byte
+		status, body, err = c.attempt(apiUrl)
+		if err == nil {
+			c.breaker.Success()
+			return status, body, nil
+		}
+	}
+
+	c.breaker.Failure()
+	return 0, nil, err
+}
+
+// A single request. Errors worth retrying are returned typed, anything else is an answer
+func (c *Client) attempt(apiUrl string) (int, []byte, error) {
+	response, err := c.http.Get(apiUrl)
+	var missing *FixtureMissingError
+	if errors.As(err, &missing) {
+		return 0, nil, missing
+	} else if err != nil {
+		return 0, nil, c.requestError(err)
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return 0, nil, c.requestError(err)
+	}
+
+	if response.StatusCode >= 500 {
+		return 0, nil, &UnavailableError{Provider: c.provider, Status: response.StatusCode}
+	}
+	return response.StatusCode, body, nil
+}
+
+func (c *Client) requestError(err error) error {
+	if netErr, isNetErr := err.(net.Error); isNetErr && netErr.Timeout() {
+		return &TimeoutError{Provider: c.provider, Err: err}
+	}
+	return &UnavailableError{Provider: c.provider, Err: err}
+}
+
+// "Full jitter" backoff: https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func backoff(attempt int) time.Duration {
+	limit := retryBackoff << uint(attempt)
+	if limit > retryMaxBackoff {
+		limit = retryMaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
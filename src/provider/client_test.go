@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A server answering the n-th request with statuses[n], the last one for the requests after them.
+// A status of 0 answers too late for testClient()
+func scriptedServer(statuses ...int) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1)) - 1
+		if n >= len(statuses) {
+			n = len(statuses) - 1
+		}
+		if statuses[n] == 0 {
+			time.Sleep(200 * time.Millisecond)
+			return
+		}
+		w.WriteHeader(statuses[n])
+		w.Write([]byte(`{"cod":200}`))
+	}))
+	return server, &requests
+}
+
+// A Client whose attempts time out after 50ms and whose waits between them are only recorded
+func testClient() (*Client, *[]time.Duration) {
+	client := NewClient("Test")
+	client.http.Timeout = 50 * time.Millisecond
+	var waits []time.Duration
+	client.sleep = func(d time.Duration) {
+		waits = append(waits, d)
+	}
+	return client, &waits
+}
+
+// Server errors and timeouts are retried up to clientAttempts in total, anything else is an answer
+func TestClientRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   int
+		wantErr      error
+		wantAttempts int
+	}{
+		{"ok", []int{200}, 200, nil, 1},
+		{"not found", []int{404}, 404, nil, 1},
+		{"server error then ok", []int{503, 200}, 200, nil, 2},
+		{"timeout then ok", []int{0, 0, 200}, 200, nil, 3},
+		{"server errors", []int{500, 502, 503, 200}, 0, &UnavailableError{}, clientAttempts},
+		{"timeouts", []int{0}, 0, &TimeoutError{}, clientAttempts},
+	}
+
+	for _, test := range tests {
+		server, requests := scriptedServer(test.statuses...)
+		client, waits := testClient()
+
+		status, _, err := client.Get(server.URL)
+		server.Close()
+
+		if status != test.wantStatus {
+			t.Errorf("%s: status %d, want %d", test.name, status, test.wantStatus)
+		}
+		if test.wantErr == nil && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if test.wantErr != nil && fmt.Sprintf("%T", err) != fmt.Sprintf("%T", test.wantErr) {
+			t.Errorf("%s: %v, want a %T", test.name, err, test.wantErr)
+		}
+		if attempts := int(atomic.LoadInt32(requests)); attempts != test.wantAttempts {
+			t.Errorf("%s: %d attempts, want %d", test.name, attempts, test.wantAttempts)
+		}
+
+		// Every retry waits up to twice as long as the one before
+		if len(*waits) != test.wantAttempts-1 {
+			t.Errorf("%s: %d waits for %d attempts", test.name, len(*waits), test.wantAttempts)
+		}
+		for i, wait := range *waits {
+			if limit := retryBackoff << uint(i+1); wait < 0 || wait >= limit || wait >= retryMaxBackoff {
+				t.Errorf("%s: wait %d of %v, want less than %v", test.name, i+1, wait, limit)
+			}
+		}
+	}
+}
+
+// The last failure of a server that keeps failing is a *UnavailableError with its status. Once
+// breakerThreshold calls failed, calls fail fast with a *CircuitOpenError until the cooldown is over
+func TestClientCircuitBreaker(t *testing.T) {
+	server, requests := scriptedServer(503)
+	defer server.Close()
+	client, _ := testClient()
+	client.breaker = NewBreaker(breakerThreshold, 50*time.Millisecond)
+
+	for i := 0; i < breakerThreshold; i++ {
+		_, _, err := client.Get(server.URL)
+		if unavailable, ok := err.(*UnavailableError); !ok || unavailable.Status != 503 {
+			t.Fatalf("call %d: %v, want a *UnavailableError with HTTP 503", i+1, err)
+		}
+	}
+
+	made := atomic.LoadInt32(requests)
+	_, _, err := client.Get(server.URL)
+	if circuitOpen, ok := err.(*CircuitOpenError); !ok || circuitOpen.Provider != "Test" || circuitOpen.RetryAt.IsZero() {
+		t.Fatalf("call with the circuit open: %v, want a *CircuitOpenError", err)
+	}
+	if atomic.LoadInt32(requests) != made {
+		t.Errorf("the server was called with the circuit open")
+	}
+
+	// The trial after the cooldown is a single call, retries included, which fails and opens the
+	// circuit again
+	time.Sleep(60 * time.Millisecond)
+	if _, _, err = client.Get(server.URL); err == nil {
+		t.Fatal("the trial call did not fail")
+	} else if _, ok := err.(*UnavailableError); !ok {
+		t.Errorf("trial call: %v, want a *UnavailableError", err)
+	}
+	if _, _, err = client.Get(server.URL); err == nil {
+		t.Fatal("the call after the failed trial did not fail")
+	} else if _, ok := err.(*CircuitOpenError); !ok {
+		t.Errorf("call after the failed trial: %v, want a *CircuitOpenError", err)
+	}
+}
+
+// Replayed responses are served from the fixtures without going through the quota or the breaker,
+// so a build machine can replay any number of them and missing ones do not open the circuit
+func TestClientReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer UseFixtures("", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"cod":200,"name":"Toronto"}`))
+	}))
+	apiUrl := server.URL + "/data/2.5/weather?id=6167865&APPID=secret"
+
+	if err = UseFixtures(FixtureRecord, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = NewClient("Test").Get(apiUrl); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	server.Close()
+
+	if err = UseFixtures(FixtureReplay, dir); err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient("Test")
+	quota := NewQuota(1, 1, 0)
+	client.SetQuota(quota)
+
+	for i := 0; i < breakerThreshold+1; i++ {
+		if _, _, err = client.Get(server.URL + "/data/2.5/weather?id=0"); err == nil {
+			t.Fatalf("replaying a request that was not recorded did not fail")
+		} else if _, missing := err.(*FixtureMissingError); !missing {
+			t.Fatalf("replaying a request that was not recorded: %v, want a *FixtureMissingError", err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		status, body, err := client.Get(apiUrl)
+		if err != nil || status != http.StatusOK || !strings.Contains(string(body), `"Toronto"`) {
+			t.Fatalf("replay %d: %d %s %v", i+1, status, body, err)
+		}
+	}
+
+	if usage := quota.Usage(); usage.Allowed != 0 || usage.Rejected != 0 {
+		t.Errorf("replayed calls were counted by the quota: %+v", usage)
+	}
+}
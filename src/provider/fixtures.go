@@ -0,0 +1,213 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Modes of UseFixtures(): provider responses are either fetched and saved as fixture files, or
+// served from the fixture files without any network access
+const (
+	FixtureRecord = "record"
+	FixtureReplay = "replay"
+)
+
+// Query parameters that are left out of fixtures, so API keys do not end up in the files
+var fixtureSecretParams = []string{"APPID", "appid"}
+
+var (
+	transportMutex sync.RWMutex
+	// The transport all clients send their requests through, see UseFixtures()
+	clientTransport http.RoundTripper = sharedTransport
+)
+
+// Send all provider requests through a fixture transport in 'mode' (FixtureRecord or FixtureReplay)
+// with the fixture files in 'dir'. An empty mode sends them to the network as usual. Clients that
+// were already created are switched too
+func UseFixtures(mode string, dir string) error {
+	var transport http.RoundTripper = sharedTransport
+	switch mode {
+	case "":
+	case FixtureRecord, FixtureReplay:
+		transport = &FixtureTransport{mode: mode, dir: dir, next: sharedTransport}
+	default:
+		return fmt.Errorf("unknown fixture mode '%s', use '%s' or '%s'", mode, FixtureRecord, FixtureReplay)
+	}
+
+	transportMutex.Lock()
+	clientTransport = transport
+	transportMutex.Unlock()
+	return nil
+}
+
+// Whether the responses are served from fixture files rather than by the services
+func replaying() bool {
+	transportMutex.RLock()
+	defer transportMutex.RUnlock()
+	fixtures, ok := clientTransport.(*FixtureTransport)
+	return ok && fixtures.mode == FixtureReplay
+}
+
+// The http.Client of every Client uses this, so the transport can be switched after the clients
+// are created
+type switchTransport struct{}
+
+func (switchTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transportMutex.RLock()
+	transport := clientTransport
+	transportMutex.RUnlock()
+	return transport.RoundTrip(request)
+}
+
+// A FixtureTransport records provider responses, error responses included, to one file per
+// request, or replays them from those files. A request is matched on its method and URL, with the
+// query parameters in any order
+type FixtureTransport struct {
+	mode string
+	dir  string
+	next http.RoundTripper
+}
+
+// What is stored in a fixture file. JSON bodies are stored as JSON so the files are easy to read
+// and edit, any other body as text
+type fixture struct {
+	Method      string          `json:"method"`
+	Url         string          `json:"url"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	BodyText    string          `json:"body_text,omitempty"`
+}
+
+// Returned in replay mode when no fixture was recorded for a request
+type FixtureMissingError struct {
+	Method string
+	Url    string
+	Path   string
+}
+
+func (e *FixtureMissingError) Error() string {
+	return fmt.Sprintf("no fixture for %s %s (expected %s)", e.Method, e.Url, e.Path)
+}
+
+func (t *FixtureTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	fixtureUrl := fixtureUrl(request.URL)
+	path := t.path(request.Method, request.URL, fixtureUrl)
+
+	if t.mode == FixtureReplay {
+		return t.replay(request, fixtureUrl, path)
+	}
+	return t.record(request, fixtureUrl, path)
+}
+
+func (t *FixtureTransport) replay(request *http.Request, fixtureUrl string, path string) (*http.Response, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, &FixtureMissingError{Method: request.Method, Url: fixtureUrl, Path: path}
+	} else if err != nil {
+		return nil, err
+	}
+
+	var recorded fixture
+	if err = json.Unmarshal(data, &recorded); err != nil {
+		return nil, fmt.Errorf("reading fixture %s: %s", path, err.Error())
+	}
+
+	body := []byte(recorded.BodyText)
+	if len(recorded.Body) > 0 {
+		body = recorded.Body
+	}
+	response := &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+	if recorded.ContentType != "" {
+		response.Header.Set("Content-Type", recorded.ContentType)
+	}
+	return response, nil
+}
+
+func (t *FixtureTransport) record(request *http.Request, fixtureUrl string, path string) (*http.Response, error) {
+	response, err := t.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	recorded := fixture{
+		Method:      request.Method,
+		Url:         fixtureUrl,
+		Status:      response.StatusCode,
+		ContentType: response.Header.Get("Content-Type"),
+	}
+	if json.Valid(body) {
+		recorded.Body = body
+	} else {
+		recorded.BodyText = string(body)
+	}
+
+	// A response that cannot be saved is still returned, the next recording run can save it
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	err = encoder.Encode(recorded)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path, data.Bytes(), 0644)
+	}
+	if err != nil {
+		log.Printf("Fixture write error> %s", err.Error())
+	}
+
+	return response, nil
+}
+
+// Fixture files are grouped by host and named after the path, e.g.
+// "api.openweathermap.org/data_2.5_weather-0123456789ab.json". The hash tells the queries apart
+func (t *FixtureTransport) path(method string, requestUrl *url.URL, fixtureUrl string) string {
+	hash := sha1.Sum([]byte(method + " " + fixtureUrl))
+	name := strings.Trim(strings.Replace(requestUrl.Path, "/", "_", -1), "_")
+	if name == "" {
+		name = "root"
+	}
+	return filepath.Join(t.dir, requestUrl.Host, name+"-"+hex.EncodeToString(hash[:6])+".json")
+}
+
+// The request URL without its secret parameters and with the others sorted
+func fixtureUrl(requestUrl *url.URL) string {
+	query := requestUrl.Query()
+	for _, param := range fixtureSecretParams {
+		query.Del(param)
+	}
+
+	stripped := *requestUrl
+	stripped.RawQuery = query.Encode()
+	return stripped.String()
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"definition"
+)
+
+// Normalized current conditions. Every adapter converts the response of its weather service into
+// an Observation, which is then mapped onto 'CurrentWeather' so the templates and JSON output
+// look the same whichever provider answered
+type Observation struct {
+	Provider    string
+	CityID      int
+	Name        string
+	Country     string
+	Lat         float32
+	Lon         float32
+	Dt          int
+	Temp        float32
+	TempMin     float32
+	TempMax     float32
+	Pressure    float32
+	Humidity    float32
+	WindSpeed   float32
+	WindDeg     float32
+	Clouds      float32
+	Rain3H      float32
+	Snow3H      float32
+	ConditionID int
+	Condition   string
+	Description string
+	// Set instead of 'Description' by providers that only report a code, see definition.Weather
+	DescriptionKey string
+	Icon           string
+	Sunrise        int
+	Sunset         int
+	// Offset of the local time from UTC in seconds
+	Timezone int
+}
+
+func (o *Observation) CurrentWeather() definition.CurrentWeather {
+	reqWeather := definition.CurrentWeather{
+		Coord:    &definition.Coord{Lon: o.Lon, Lat: o.Lat},
+		Main:     &definition.Main{Temp: o.Temp, Pressure: o.Pressure, Humidity: o.Humidity, TempMin: o.TempMin, TempMax: o.TempMax},
+		Wind:     &definition.Wind{Speed: o.WindSpeed, Deg: o.WindDeg},
+		Clouds:   &definition.Clouds{All: o.Clouds},
+		Dt:       o.Dt,
+		Sys:      &definition.Sys{Country: o.Country, Sunrise: o.Sunrise, Sunset: o.Sunset},
+		CityId:   o.CityID,
+		Name:     o.Name,
+		Code:     200,
+		Provider: o.Provider,
+		Timezone: o.Timezone,
+	}
+
+	if o.Description != "" || o.DescriptionKey != "" {
+		reqWeather.Weather = []*definition.Weather{{Id: o.ConditionID, Main: o.Condition, Description: o.Description,
+			Icon: o.Icon, DescriptionKey: o.DescriptionKey}}
+	}
+	if o.Rain3H > 0 {
+		reqWeather.Rain = &definition.Rain{RainVolume3H: o.Rain3H}
+	}
+	if o.Snow3H > 0 {
+		reqWeather.Snow = &definition.Snow{SnowVolume3H: o.Snow3H}
+	}
+
+	return reqWeather
+}
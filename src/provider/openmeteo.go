@@ -0,0 +1,289 @@
+package provider
+
+import (
+	"definition"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// WeatherProvider backed by Open-Meteo (https://open-meteo.com/en/docs), which needs no API key.
+// It only knows coordinates, so names are resolved with its geocoding API first
+type OpenMeteo struct {
+	baseUrl      string
+	geocodingUrl string
+	client       *Client
+	cityRegion   func(id string) string
+}
+
+// Open-Meteo has no notion of OpenWeatherMap city ids, 'cityRegion' maps an id from the 'city'
+// table to its region name (e.g. "London, GB") so it can be geocoded instead
+func NewOpenMeteo(cityRegion func(id string) string) *OpenMeteo {
+	return &OpenMeteo{
+		baseUrl:      "https://api.open-meteo.com/v1",
+		geocodingUrl: "https://geocoding-api.open-meteo.com/v1",
+		client:       NewClient("Open-Meteo"),
+		cityRegion:   cityRegion,
+	}
+}
+
+type openMeteoPlace struct {
+	Name        string  `json:"name"`
+	Latitude    float32 `json:"latitude"`
+	Longitude   float32 `json:"longitude"`
+	CountryCode string  `json:"country_code"`
+}
+
+type openMeteoCurrent struct {
+	Latitude  float32 `json:"latitude"`
+	Longitude float32 `json:"longitude"`
+	UtcOffset int     `json:"utc_offset_seconds"`
+	Current   struct {
+		Time          int     `json:"time"`
+		Temperature   float32 `json:"temperature_2m"`
+		Humidity      float32 `json:"relative_humidity_2m"`
+		Pressure      float32 `json:"pressure_msl"`
+		WindSpeed     float32 `json:"wind_speed_10m"`
+		WindDirection float32 `json:"wind_direction_10m"`
+		CloudCover    float32 `json:"cloud_cover"`
+		WeatherCode   int     `json:"weather_code"`
+		IsDay         int     `json:"is_day"`
+	} `json:"current"`
+	Daily struct {
+		TempMax []float32 `json:"temperature_2m_max"`
+		TempMin []float32 `json:"temperature_2m_min"`
+		Sunrise []int     `json:"sunrise"`
+		Sunset  []int     `json:"sunset"`
+	} `json:"daily"`
+}
+
+func (p *OpenMeteo) ByCityID(id string, opts Options) (definition.CurrentWeather, error) {
+	if p.cityRegion == nil {
+		return definition.CurrentWeather{}, ErrUnsupported
+	}
+
+	region := p.cityRegion(id)
+	if region == "" {
+		return definition.CurrentWeather{}, ErrNotFound
+	}
+
+	reqWeather, err := p.ByName(region, opts)
+	if err == nil {
+		reqWeather.CityId, _ = strconv.Atoi(id)
+	}
+	return reqWeather, err
+}
+
+// Lookup by free-text name, optionally followed by a country code as in "London,uk"
+func (p *OpenMeteo) ByName(name string, opts Options) (definition.CurrentWeather, error) {
+	place, err := p.geocode(name)
+	if err != nil {
+		return definition.CurrentWeather{}, err
+	}
+
+	observation, err := p.observe(place.Latitude, place.Longitude, opts)
+	if err != nil {
+		return definition.CurrentWeather{}, err
+	}
+	observation.Name = place.Name
+	observation.Country = place.CountryCode
+
+	return observation.CurrentWeather(), nil
+}
+
+func (p *OpenMeteo) ByCoord(lat float32, lon float32, opts Options) (definition.CurrentWeather, error) {
+	observation, err := p.observe(lat, lon, opts)
+	if err != nil {
+		return definition.CurrentWeather{}, err
+	}
+	return observation.CurrentWeather(), nil
+}
+
+// The geocoding API also searches postal codes, so they are looked up like a name
+func (p *OpenMeteo) ByZip(zip string, country string, opts Options) (definition.CurrentWeather, error) {
+	return p.ByName(zip+","+country, opts)
+}
+
+// The geocoding API does not understand "city,country", so the country is matched against the
+// results instead
+func (p *OpenMeteo) geocode(name string) (*openMeteoPlace, error) {
+	country := ""
+	if i := strings.LastIndex(name, ","); i >= 0 {
+		country = countryCode(name[i+1:])
+		name = strings.TrimSpace(name[:i])
+	}
+	if name == "" {
+		return nil, &Error{Code: 400, Message: "Nothing to geocode"}
+	}
+
+	params := url.Values{}
+	params.Set("name", name)
+	params.Set("count", "10")
+
+	var places struct {
+		Results []*openMeteoPlace `json:"results"`
+	}
+	if err := p.get(p.geocodingUrl+"/search", params, &places); err != nil {
+		return nil, err
+	}
+
+	for _, place := range places.Results {
+		if country == "" || place.CountryCode == country {
+			return place, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (p *OpenMeteo) observe(lat float32, lon float32, opts Options) (*Observation, error) {
+	params := url.Values{}
+	params.Set("latitude", strconv.FormatFloat(float64(lat), 'f', -1, 32))
+	params.Set("longitude", strconv.FormatFloat(float64(lon), 'f', -1, 32))
+	params.Set("current", "temperature_2m,relative_humidity_2m,pressure_msl,wind_speed_10m,wind_direction_10m,cloud_cover,weather_code,is_day")
+	params.Set("daily", "temperature_2m_max,temperature_2m_min,sunrise,sunset")
+	params.Set("forecast_days", "1")
+	params.Set("timeformat", "unixtime")
+	params.Set("timezone", "auto")
+	if opts.Units == "imperial" {
+		params.Set("temperature_unit", "fahrenheit")
+		params.Set("wind_speed_unit", "mph")
+	} else {
+		params.Set("wind_speed_unit", "ms")
+	}
+
+	var raw openMeteoCurrent
+	if err := p.get(p.baseUrl+"/forecast", params, &raw); err != nil {
+		return nil, err
+	}
+
+	current := raw.Current
+	if current.Time == 0 {
+		return nil, errors.New("incomplete Open-Meteo response, 'current' is missing")
+	}
+
+	condition, icon := wmoCondition(current.WeatherCode)
+	if current.IsDay == 1 {
+		icon += "d"
+	} else {
+		icon += "n"
+	}
+
+	observation := &Observation{
+		Provider:    "Open-Meteo",
+		Lat:         raw.Latitude,
+		Lon:         raw.Longitude,
+		Dt:          current.Time,
+		Temp:        current.Temperature,
+		TempMin:     current.Temperature,
+		TempMax:     current.Temperature,
+		Pressure:    current.Pressure,
+		Humidity:    current.Humidity,
+		WindSpeed:   current.WindSpeed,
+		WindDeg:     current.WindDirection,
+		Clouds:      current.CloudCover,
+		ConditionID: condition.id,
+		Condition:   condition.main,
+		// Open-Meteo only has codes, so the description is left to the handlers to translate
+		DescriptionKey: condition.descriptionKey,
+		Icon:           icon,
+		Timezone:       raw.UtcOffset,
+	}
+	if len(raw.Daily.TempMin) > 0 && len(raw.Daily.TempMax) > 0 {
+		observation.TempMin, observation.TempMax = raw.Daily.TempMin[0], raw.Daily.TempMax[0]
+	}
+	if len(raw.Daily.Sunrise) > 0 && len(raw.Daily.Sunset) > 0 {
+		observation.Sunrise, observation.Sunset = raw.Daily.Sunrise[0], raw.Daily.Sunset[0]
+	}
+
+	// Open-Meteo has no Kelvin option, 'standard' units are converted here
+	if opts.Units != "metric" && opts.Units != "imperial" {
+		observation.Temp += 273.15
+		observation.TempMin += 273.15
+		observation.TempMax += 273.15
+	}
+
+	return observation, nil
+}
+
+// Open-Meteo reports errors as {"error":true,"reason":"Latitude must be in range of -90 to 90°."}
+func (p *OpenMeteo) get(apiUrl string, params url.Values, v interface{}) error {
+	status, body, err := p.client.Get(apiUrl + "?" + params.Encode())
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		var apiError struct {
+			Reason string `json:"reason"`
+		}
+		json.Unmarshal(body, &apiError)
+		return &Error{Code: status, Message: apiError.Reason}
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding Open-Meteo response: %s", err.Error())
+	}
+	return nil
+}
+
+// The description is the key of its message in the catalogs, after "condition."
+type condition struct {
+	id             int
+	main           string
+	descriptionKey string
+}
+
+// Map a WMO weather interpretation code (https://open-meteo.com/en/docs#weathervariables) onto the
+// closest OpenWeatherMap condition and icon (without the day/night suffix), so the results page
+// can keep using the OpenWeatherMap icons
+func wmoCondition(code int) (condition, string) {
+	switch code {
+	case 0:
+		return condition{800, "Clear", "clear_sky"}, "01"
+	case 1:
+		return condition{801, "Clouds", "mainly_clear"}, "02"
+	case 2:
+		return condition{802, "Clouds", "partly_cloudy"}, "03"
+	case 3:
+		return condition{804, "Clouds", "overcast_clouds"}, "04"
+	case 45, 48:
+		return condition{741, "Fog", "fog"}, "50"
+	case 51, 53, 55:
+		return condition{301, "Drizzle", "drizzle"}, "09"
+	case 56, 57:
+		return condition{511, "Rain", "freezing_drizzle"}, "13"
+	case 61:
+		return condition{500, "Rain", "light_rain"}, "10"
+	case 63:
+		return condition{501, "Rain", "moderate_rain"}, "10"
+	case 65:
+		return condition{502, "Rain", "heavy_intensity_rain"}, "10"
+	case 66, 67:
+		return condition{511, "Rain", "freezing_rain"}, "13"
+	case 71:
+		return condition{600, "Snow", "light_snow"}, "13"
+	case 73, 77:
+		return condition{601, "Snow", "snow"}, "13"
+	case 75:
+		return condition{602, "Snow", "heavy_snow"}, "13"
+	case 80:
+		return condition{520, "Rain", "light_intensity_shower_rain"}, "09"
+	case 81:
+		return condition{521, "Rain", "shower_rain"}, "09"
+	case 82:
+		return condition{522, "Rain", "heavy_intensity_shower_rain"}, "09"
+	case 85:
+		return condition{620, "Snow", "light_shower_snow"}, "13"
+	case 86:
+		return condition{621, "Snow", "shower_snow"}, "13"
+	case 95:
+		return condition{211, "Thunderstorm", "thunderstorm"}, "11"
+	case 96, 99:
+		return condition{202, "Thunderstorm", "thunderstorm_with_hail"}, "11"
+	}
+	return condition{}, "01"
+}
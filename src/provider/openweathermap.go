@@ -0,0 +1,277 @@
+package provider
+
+import (
+	"definition"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// WeatherProvider backed by the OpenWeatherMap API: https://openweathermap.org/current
+type OpenWeatherMap struct {
+	apiKey     string
+	baseUrl    string
+	oneCallUrl string
+	client     *Client
+}
+
+func NewOpenWeatherMap(apiKey string) *OpenWeatherMap {
+	return &OpenWeatherMap{
+		apiKey:     apiKey,
+		baseUrl:    "http://api.openweathermap.org/data/2.5",
+		oneCallUrl: "http://api.openweathermap.org/data/3.0/onecall",
+		client:     NewClient("OpenWeatherMap"),
+	}
+}
+
+// Every call to the API, whatever it is for, takes a token from 'quota' first
+func (p *OpenWeatherMap) SetQuota(quota *Quota) {
+	p.client.SetQuota(quota)
+}
+
+// Lookup by the city id from the 'city' table (same ids as OpenWeatherMap's city.list.json)
+func (p *OpenWeatherMap) ByCityID(id string, opts Options) (definition.CurrentWeather, error) {
+	params := url.Values{}
+	params.Set("id", id)
+	return p.current(params, opts)
+}
+
+// Lookup by free-text city name, e.g. "London" or "London,uk"
+func (p *OpenWeatherMap) ByName(name string, opts Options) (definition.CurrentWeather, error) {
+	params := url.Values{}
+	params.Set("q", name)
+	return p.current(params, opts)
+}
+
+func (p *OpenWeatherMap) ByCoord(lat float32, lon float32, opts Options) (definition.CurrentWeather, error) {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(float64(lat), 'f', -1, 32))
+	params.Set("lon", strconv.FormatFloat(float64(lon), 'f', -1, 32))
+	return p.current(params, opts)
+}
+
+// Lookup by postal code, sent as "zip=M5V,CA"
+func (p *OpenWeatherMap) ByZip(zip string, country string, opts Options) (definition.CurrentWeather, error) {
+	params := url.Values{}
+	params.Set("zip", zip+","+country)
+	return p.current(params, opts)
+}
+
+func (p *OpenWeatherMap) ForecastByCityID(id string, opts Options) (definition.Forecast, error) {
+	params := url.Values{}
+	params.Set("id", id)
+	return p.forecast(params, opts)
+}
+
+func (p *OpenWeatherMap) ForecastByName(name string, opts Options) (definition.Forecast, error) {
+	params := url.Values{}
+	params.Set("q", name)
+	return p.forecast(params, opts)
+}
+
+func (p *OpenWeatherMap) ForecastByCoord(lat float32, lon float32, opts Options) (definition.Forecast, error) {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(float64(lat), 'f', -1, 32))
+	params.Set("lon", strconv.FormatFloat(float64(lon), 'f', -1, 32))
+	return p.forecast(params, opts)
+}
+
+func (p *OpenWeatherMap) ForecastByZip(zip string, country string, opts Options) (definition.Forecast, error) {
+	params := url.Values{}
+	params.Set("zip", zip+","+country)
+	return p.forecast(params, opts)
+}
+
+// The request is sent to the '/weather' endpoint and the JSON result is decoded into the
+// 'CurrentWeather' struct, which is then normalized like the other providers
+func (p *OpenWeatherMap) current(params url.Values, opts Options) (definition.CurrentWeather, error) {
+	var raw = definition.CurrentWeather{}
+	if err := p.get("/weather", params, opts, &raw); err != nil {
+		return raw, err
+	}
+
+	observation, err := observationFromOpenWeatherMap(raw)
+	if err != nil {
+		return raw, err
+	}
+	return observation.CurrentWeather(), nil
+}
+
+func observationFromOpenWeatherMap(raw definition.CurrentWeather) (*Observation, error) {
+	if raw.Main == nil {
+		return nil, errors.New("incomplete OpenWeatherMap response, 'main' is missing")
+	}
+
+	observation := &Observation{
+		Provider: "OpenWeatherMap",
+		CityID:   raw.CityId,
+		Name:     raw.Name,
+		Dt:       raw.Dt,
+		Temp:     raw.Main.Temp,
+		TempMin:  raw.Main.TempMin,
+		TempMax:  raw.Main.TempMax,
+		Pressure: raw.Main.Pressure,
+		Humidity: raw.Main.Humidity,
+		Timezone: raw.Timezone,
+	}
+	if raw.Coord != nil {
+		observation.Lat, observation.Lon = raw.Coord.Lat, raw.Coord.Lon
+	}
+	if raw.Sys != nil {
+		observation.Country, observation.Sunrise, observation.Sunset = raw.Sys.Country, raw.Sys.Sunrise, raw.Sys.Sunset
+	}
+	if raw.Wind != nil {
+		observation.WindSpeed, observation.WindDeg = raw.Wind.Speed, raw.Wind.Deg
+	}
+	if raw.Clouds != nil {
+		observation.Clouds = raw.Clouds.All
+	}
+	if raw.Rain != nil {
+		observation.Rain3H = raw.Rain.RainVolume3H
+	}
+	if raw.Snow != nil {
+		observation.Snow3H = raw.Snow.SnowVolume3H
+	}
+	if len(raw.Weather) > 0 {
+		weather := raw.Weather[0]
+		observation.ConditionID, observation.Condition = weather.Id, weather.Main
+		observation.Description, observation.Icon = weather.Description, weather.Icon
+	}
+
+	return observation, nil
+}
+
+// The request is sent to the '/forecast' endpoint which returns 40 items, one every 3 hours
+func (p *OpenWeatherMap) forecast(params url.Values, opts Options) (definition.Forecast, error) {
+	var reqForecast = definition.Forecast{}
+	err := p.get("/forecast", params, opts, &reqForecast)
+	return reqForecast, err
+}
+
+// Current air pollution from the '/air_pollution' endpoint, which answers with a list holding a
+// single entry: {"coord":{...},"list":[{"main":{"aqi":2},"components":{...},"dt":1606147200}]}
+func (p *OpenWeatherMap) AirQuality(lat float32, lon float32) (definition.AirQuality, error) {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(float64(lat), 'f', -1, 32))
+	params.Set("lon", strconv.FormatFloat(float64(lon), 'f', -1, 32))
+
+	var raw struct {
+		List []struct {
+			Main struct {
+				Aqi int `json:"aqi"`
+			} `json:"main"`
+			Components *definition.AirComponents `json:"components"`
+			Dt         int                       `json:"dt"`
+		} `json:"list"`
+	}
+	if err := p.get("/air_pollution", params, Options{}, &raw); err != nil {
+		return definition.AirQuality{}, err
+	}
+	if len(raw.List) == 0 || raw.List[0].Main.Aqi == 0 {
+		return definition.AirQuality{}, ErrNotFound
+	}
+
+	return definition.AirQuality{Aqi: raw.List[0].Main.Aqi, Components: raw.List[0].Components, Dt: raw.List[0].Dt}, nil
+}
+
+// Alerts come from the One Call API, everything but the alerts is excluded from the answer.
+// OpenWeatherMap passes the alerts on as issued and has no severity, so it is worked out from the
+// event name
+func (p *OpenWeatherMap) Alerts(lat float32, lon float32) ([]*definition.Alert, error) {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(float64(lat), 'f', -1, 32))
+	params.Set("lon", strconv.FormatFloat(float64(lon), 'f', -1, 32))
+	params.Set("exclude", "current,minutely,hourly,daily")
+
+	var raw struct {
+		Alerts []*definition.Alert `json:"alerts"`
+	}
+	if err := p.fetch(p.oneCallUrl, params, Options{}, &raw); err != nil {
+		return nil, err
+	}
+
+	for _, alert := range raw.Alerts {
+		alert.Severity = alertSeverity(alert.Event)
+	}
+	return raw.Alerts, nil
+}
+
+// Most services name their alerts after the severity, e.g. "Tornado Warning" (NWS) or "Orange wind
+// warning" (MeteoAlarm). The first word in this list found in the event name decides
+var alertSeverityWords = []struct {
+	word     string
+	severity string
+}{
+	// MeteoAlarm colours come first, its yellow warnings are only moderate
+	{"red", "extreme"},
+	{"orange", "severe"},
+	{"yellow", "moderate"},
+	{"emergency", "extreme"},
+	{"extreme", "extreme"},
+	{"warning", "severe"},
+	{"watch", "moderate"},
+	{"advisory", "minor"},
+	{"statement", "minor"},
+}
+
+func alertSeverity(event string) string {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(strings.ToLower(event)) {
+		words[strings.Trim(word, ".,:;!()")] = true
+	}
+
+	for _, severityWord := range alertSeverityWords {
+		if words[severityWord.word] {
+			return severityWord.severity
+		}
+	}
+	return "unknown"
+}
+
+func (p *OpenWeatherMap) get(path string, params url.Values, opts Options, v interface{}) error {
+	return p.fetch(p.baseUrl+path, params, opts, v)
+}
+
+func (p *OpenWeatherMap) fetch(apiUrl string, params url.Values, opts Options, v interface{}) error {
+	params.Set("type", "accurate")
+	params.Set("mode", "json")
+	params.Set("APPID", p.apiKey)
+	if opts.Units != "" {
+		params.Set("units", opts.Units)
+	}
+	if opts.Lang != "" {
+		params.Set("lang", opts.Lang)
+	}
+
+	status, body, err := p.client.Get(apiUrl + "?" + params.Encode())
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return decodeError(status, body)
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding OpenWeatherMap response: %s", err.Error())
+	}
+	return nil
+}
+
+// OpenWeatherMap reports errors as {"cod":"404","message":"city not found"}, where 'cod' is a string
+// even though it is a number on success
+func decodeError(status int, body []byte) error {
+	var apiError struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &apiError)
+
+	if status == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return &Error{Code: status, Message: apiError.Message}
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"definition"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// Returned when the provider does not know the requested location
+	ErrNotFound = errors.New("location not found")
+	// Returned when the provider cannot look up a location that way, e.g. by OpenWeatherMap city id
+	ErrUnsupported = errors.New("lookup not supported by this provider")
+	// Returned without calling upstream when the API key's quota is used up
+	ErrQuotaExceeded = errors.New("API quota exceeded")
+)
+
+// Options that are sent along with every lookup
+type Options struct {
+	Units string
+	// Language of the weather descriptions, e.g. "fr"
+	Lang string
+}
+
+// A WeatherProvider retrieves the current weather for a location. The HTTP handlers only talk to
+// this interface, so a different weather service or an in-process fake can be plugged in without
+// touching them
+type WeatherProvider interface {
+	ByCityID(id string, opts Options) (definition.CurrentWeather, error)
+	ByName(name string, opts Options) (definition.CurrentWeather, error)
+	ByCoord(lat float32, lon float32, opts Options) (definition.CurrentWeather, error)
+	// Lookup by postal code within an ISO 3166 country, e.g. ("M5V", "CA")
+	ByZip(zip string, country string, opts Options) (definition.CurrentWeather, error)
+}
+
+// An AirQualityProvider retrieves the current air pollution at a coordinate
+type AirQualityProvider interface {
+	AirQuality(lat float32, lon float32) (definition.AirQuality, error)
+}
+
+// An AlertProvider retrieves the weather alerts in force or announced for a coordinate
+type AlertProvider interface {
+	Alerts(lat float32, lon float32) ([]*definition.Alert, error)
+}
+
+// Error reported by the upstream API, e.g. {"cod":"400","message":"Nothing to geocode"}
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("provider error %d: %s", e.Code, e.Message)
+}
+
+// The upstream API turned the call down for reasons of its own, a refused key (401, 403) or too
+// many calls (429), rather than because of the location. Until that changes it is as good as
+// unavailable
+func (e *Error) Refused() bool {
+	return e.Code == http.StatusUnauthorized || e.Code == http.StatusForbidden || e.Code == http.StatusTooManyRequests
+}
+
+// The upstream API did not answer in time, even after retrying
+type TimeoutError struct {
+	Provider string
+	Err      error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out: %s", e.Provider, e.Err.Error())
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// The upstream API could not be reached or kept answering with a server error (5xx). 'Status' is
+// 0 when no response was received
+type UnavailableError struct {
+	Provider string
+	Status   int
+	Err      error
+}
+
+func (e *UnavailableError) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("%s unavailable: HTTP %d", e.Provider, e.Status)
+	}
+	return fmt.Sprintf("%s unavailable: %s", e.Provider, e.Err.Error())
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Calls to the upstream API failed too often in a row, so they are not made until 'RetryAt'
+type CircuitOpenError struct {
+	Provider string
+	RetryAt  time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s is failing, not calling it until %s", e.Provider, e.RetryAt.Format(time.RFC3339))
+}
+
+// A ForecastProvider retrieves the five day / three hour forecast for a location
+type ForecastProvider interface {
+	ForecastByCityID(id string, opts Options) (definition.Forecast, error)
+	ForecastByName(name string, opts Options) (definition.Forecast, error)
+	ForecastByCoord(lat float32, lon float32, opts Options) (definition.Forecast, error)
+	ForecastByZip(zip string, country string, opts Options) (definition.Forecast, error)
+}
+
+// The ISO 3166 code of a country as typed by a user. Users type "UK" for the United Kingdom, but
+// its code is "GB", which is the one the providers and the 'city' table use
+func countryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "UK" {
+		return "GB"
+	}
+	return code
+}
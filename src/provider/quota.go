@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+// A Quota governs the calls made with an API key, so a free-tier key shared by every user is not
+// blocked upstream. The minute budget is a token bucket that refills evenly over the minute. The
+// day budget is counted per UTC calendar day, like the provider and the 'apiUsage' table count
+// it, and starts over at midnight UTC. A call needs a token and room in the day's budget. A nil
+// Quota allows everything
+type Quota struct {
+	perMinute int
+	perDay    int
+
+	mutex        sync.Mutex
+	minuteTokens float64
+	updated      time.Time
+	day          string
+	usedToday    int
+
+	allowed  uint64
+	rejected uint64
+	record   func(allowed bool)
+}
+
+// Consumption of a Quota since the program started, the tokens left in the minute bucket and the
+// calls left today
+type QuotaUsage struct {
+	PerMinute       int
+	PerDay          int
+	MinuteRemaining int
+	DayRemaining    int
+	Allowed         uint64
+	Rejected        uint64
+}
+
+// 'usedToday' is the number of calls already made today (UTC), e.g. before a restart, which is
+// taken off the daily budget
+func NewQuota(perMinute int, perDay int, usedToday int) *Quota {
+	now := time.Now()
+	return &Quota{
+		perMinute:    perMinute,
+		perDay:       perDay,
+		minuteTokens: float64(perMinute),
+		updated:      now,
+		day:          utcDay(now),
+		usedToday:    usedToday,
+	}
+}
+
+// Take the calls already made today (UTC) off the daily budget, e.g. as counted before a restart
+func (q *Quota) SetUsedToday(usedToday int) {
+	q.mutex.Lock()
+	q.refill(time.Now())
+	q.usedToday = usedToday
+	q.mutex.Unlock()
+}
+
+// Call 'record' after every call that was allowed or rejected, e.g. to keep usage counters. It
+// runs outside of the Quota's lock
+func (q *Quota) OnUse(record func(allowed bool)) {
+	q.mutex.Lock()
+	q.record = record
+	q.mutex.Unlock()
+}
+
+// Take a token for one call, ErrQuotaExceeded is returned when either budget is used up
+func (q *Quota) Take() error {
+	if q == nil {
+		return nil
+	}
+	return q.take(time.Now())
+}
+
+func (q *Quota) take(now time.Time) error {
+	q.mutex.Lock()
+	q.refill(now)
+	allowed := q.minuteTokens >= 1 && q.usedToday < q.perDay
+	if allowed {
+		q.minuteTokens--
+		q.usedToday++
+		q.allowed++
+	} else {
+		q.rejected++
+	}
+	record := q.record
+	q.mutex.Unlock()
+
+	if record != nil {
+		record(allowed)
+	}
+	if !allowed {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (q *Quota) Usage() QuotaUsage {
+	return q.usage(time.Now())
+}
+
+func (q *Quota) usage(now time.Time) QuotaUsage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.refill(now)
+	dayRemaining := q.perDay - q.usedToday
+	if dayRemaining < 0 {
+		dayRemaining = 0
+	}
+	return QuotaUsage{
+		PerMinute:       q.perMinute,
+		PerDay:          q.perDay,
+		MinuteRemaining: int(q.minuteTokens),
+		DayRemaining:    dayRemaining,
+		Allowed:         q.allowed,
+		Rejected:        q.rejected,
+	}
+}
+
+// Must be called with the mutex held
+func (q *Quota) refill(now time.Time) {
+	if day := utcDay(now); day != q.day {
+		q.day = day
+		q.usedToday = 0
+	}
+
+	elapsed := now.Sub(q.updated)
+	if elapsed <= 0 {
+		return
+	}
+	q.updated = now
+
+	q.minuteTokens += float64(q.perMinute) * elapsed.Seconds() / time.Minute.Seconds()
+	if q.minuteTokens > float64(q.perMinute) {
+		q.minuteTokens = float64(q.perMinute)
+	}
+}
+
+func utcDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"testing"
+	"time"
+)
+
+func quotaAt(perMinute int, perDay int, usedToday int, now time.Time) *Quota {
+	q := NewQuota(perMinute, perDay, usedToday)
+	q.updated = now
+	q.day = utcDay(now)
+	return q
+}
+
+// The day budget does not refill during the day, however long it is spread out
+func TestQuotaDayBudget(t *testing.T) {
+	morning := time.Date(2024, 3, 10, 0, 30, 0, 0, time.UTC)
+	q := quotaAt(60, 5, 2, morning)
+
+	for i := 0; i < 3; i++ {
+		if err := q.take(morning.Add(time.Duration(i) * time.Hour)); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if err := q.take(morning.Add(23 * time.Hour)); err != ErrQuotaExceeded {
+		t.Errorf("call after the day's budget: %v, want ErrQuotaExceeded", err)
+	}
+	if usage := q.usage(morning.Add(23 * time.Hour)); usage.DayRemaining != 0 || usage.Allowed != 3 || usage.Rejected != 1 {
+		t.Errorf("usage = %+v, want none remaining, 3 allowed and 1 rejected", usage)
+	}
+}
+
+func TestQuotaDayStartsAtMidnightUtc(t *testing.T) {
+	evening := time.Date(2024, 3, 10, 23, 59, 0, 0, time.UTC)
+	q := quotaAt(60, 2, 2, evening)
+
+	if err := q.take(evening); err != ErrQuotaExceeded {
+		t.Fatalf("call with the budget used up: %v, want ErrQuotaExceeded", err)
+	}
+
+	// Midnight UTC is still the evening before in Toronto
+	toronto := time.FixedZone("EST", -5*60*60)
+	midnight := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC).In(toronto)
+	if err := q.take(midnight); err != nil {
+		t.Fatalf("first call of the next day: %v", err)
+	}
+	if usage := q.usage(midnight); usage.DayRemaining != 1 {
+		t.Errorf("DayRemaining = %d, want 1", usage.DayRemaining)
+	}
+}
+
+func TestQuotaMinuteBucket(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	q := quotaAt(2, 1000, 0, now)
+
+	for i := 0; i < 2; i++ {
+		if err := q.take(now); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if err := q.take(now); err != ErrQuotaExceeded {
+		t.Errorf("third call in the same second: %v, want ErrQuotaExceeded", err)
+	}
+
+	// Half a minute refills half of the bucket
+	if err := q.take(now.Add(30 * time.Second)); err != nil {
+		t.Errorf("call after 30 seconds: %v", err)
+	}
+	if err := q.take(now.Add(30 * time.Second)); err != ErrQuotaExceeded {
+		t.Errorf("second call after 30 seconds: %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestNilQuota(t *testing.T) {
+	var q *Quota
+	if err := q.Take(); err != nil {
+		t.Errorf("nil Quota: %v", err)
+	}
+}
+
+// Calls counted before a restart are taken off the day budget, the minute bucket is left as it is
+func TestQuotaSetUsedToday(t *testing.T) {
+	q := NewQuota(60, 5, 0)
+	q.SetUsedToday(4)
+
+	if err := q.Take(); err != nil {
+		t.Fatalf("last call of the day: %v", err)
+	}
+	if err := q.Take(); err != ErrQuotaExceeded {
+		t.Errorf("call after the day's budget: %v, want ErrQuotaExceeded", err)
+	}
+	if usage := q.Usage(); usage.DayRemaining != 0 || usage.MinuteRemaining != 59 {
+		t.Errorf("usage = %+v, want none remaining today and 59 this minute", usage)
+	}
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Postal code formats of the countries searched most. A code typed without a country is only looked
+// up when exactly one of them matches, "10001" could be New York as well as a town in France
+var postalCodeFormats = []struct {
+	Country string
+	Pattern *regexp.Regexp
+}{
+	{"CA", regexp.MustCompile(`^[A-Z]\d[A-Z]( ?\d[A-Z]\d)?$`)},
+	{"GB", regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`)},
+	{"NL", regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`)},
+	{"US", regexp.MustCompile(`^\d{5}(-\d{4})?$`)},
+	{"DE", regexp.MustCompile(`^\d{5}$`)},
+	{"FR", regexp.MustCompile(`^\d{5}$`)},
+	{"ES", regexp.MustCompile(`^\d{5}$`)},
+	{"IT", regexp.MustCompile(`^\d{5}$`)},
+	{"MX", regexp.MustCompile(`^\d{5}$`)},
+	{"AU", regexp.MustCompile(`^\d{4}$`)},
+	{"CH", regexp.MustCompile(`^\d{4}$`)},
+	{"AT", regexp.MustCompile(`^\d{4}$`)},
+	{"IN", regexp.MustCompile(`^\d{6}$`)},
+	{"JP", regexp.MustCompile(`^\d{3}-\d{4}$`)},
+	{"BR", regexp.MustCompile(`^\d{5}-\d{3}$`)},
+}
+
+// Returned by ParseZip when the postal code has no country and fits several countries' formats
+type AmbiguousZipError struct {
+	Zip       string
+	Countries []string
+}
+
+func (e *AmbiguousZipError) Error() string {
+	return fmt.Sprintf("postal code %s is used in several countries (%s)", e.Zip, strings.Join(e.Countries, ", "))
+}
+
+// Splits a postal code search such as "M5V, CA" or "10001" into the code and its ISO 3166 country.
+// Without a country it is guessed from the format of the code, which fails with an
+// *AmbiguousZipError if several countries use that format
+func ParseZip(input string) (string, string, error) {
+	zip, country := strings.ToUpper(strings.TrimSpace(input)), ""
+	if i := strings.LastIndex(zip, ","); i >= 0 {
+		country = countryCode(zip[i+1:])
+		zip = strings.TrimSpace(zip[:i])
+	}
+	if zip == "" {
+		return "", "", &Error{Code: 400, Message: "Nothing to geocode"}
+	}
+	if country != "" {
+		return zip, country, nil
+	}
+
+	var countries []string
+	for _, format := range postalCodeFormats {
+		if format.Pattern.MatchString(zip) {
+			countries = append(countries, format.Country)
+		}
+	}
+	switch len(countries) {
+	case 0:
+		return "", "", ErrNotFound
+	case 1:
+		return zip, countries[0], nil
+	}
+	return "", "", &AmbiguousZipError{Zip: zip, Countries: countries}
+}
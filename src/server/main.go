@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"handler"
 	"helper"
+	"provider"
 	"session"
+	"settings"
 	"time"
 	"os/signal"
 	"os"
@@ -17,14 +19,34 @@ import (
 
 var (
 	command = flag.String("display", "", "history")
+	fixtures = flag.String("fixtures", settings.FIXTUREMODE, "record or replay provider responses")
 )
 
 func main() {
+	flag.Parse()
+
+	if err := helper.OpenDB(settings.DBFILE); err != nil {
+		log.Fatalf("Database error> %s", err.Error())
+	}
+	handler.LoadApiUsage()
+
 	// Display user session history in command line
 	// Usage: --display=history
-	flag.Parse()
 	helper.PrintSessionHistory(*command)
 
+	// Import or refresh the 'city' table from OpenWeatherMap's city list, then exit
+	// Usage: importcities [file or URL of city.list.json.gz]
+	if flag.Arg(0) == "importcities" {
+		importCities(flag.Arg(1))
+		return
+	}
+
+	// Record the provider responses to fixture files, or serve them from there without network access
+	// Usage: --fixtures=record or --fixtures=replay
+	if err := provider.UseFixtures(*fixtures, settings.FIXTUREDIR); err != nil {
+		log.Fatalf("Fixtures error> %s", err.Error())
+	}
+
 	quit := make(chan struct{})
 	go session.CleanSessions(1*time.Hour, quit)
 
@@ -41,14 +63,44 @@ func main() {
 		os.Exit(0)
 	}()
 
+	// Reload the city indexes, e.g. after running importcities next to the server: kill -HUP <pid>
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	go func() {
+		for range reload {
+			helper.ReloadCityIndex()
+			helper.LoadCityPrefixIndex()
+			helper.LoadCityFuzzyIndex()
+		}
+	}()
+
+	// The autocomplete is served from memory
+	helper.LoadCityPrefixIndex()
+	helper.LoadCityFuzzyIndex()
+
 	http.HandleFunc("/", handler.RootHandler)
 	http.HandleFunc("/hello", handler.HelloHandler)
 	http.HandleFunc("/search", handler.SearchHandler)
+	http.HandleFunc("/forecast", handler.ForecastHandler)
+	http.HandleFunc("/forecast.json", handler.ForecastJsonHandler)
+	http.HandleFunc("/compare", handler.CompareHandler)
+	http.HandleFunc("/history/", handler.HistoryHandler)
 	http.HandleFunc("/createuser", handler.CreateUserHandler)
 	http.HandleFunc("/login", handler.LoginHandler)
 	http.HandleFunc("/passwordreset", handler.PasswordResetHandler)
 	http.HandleFunc("/logout", handler.LogoutHandler)
+	http.HandleFunc("/preferences", handler.PreferencesHandler)
 	http.HandleFunc("/citylist.json", handler.CityHandler)
+	http.HandleFunc("/admin/usage", handler.AdminUsageHandler)
+
+	// JSON API
+	http.HandleFunc("/api/v1/token", handler.ApiTokenHandler)
+	http.HandleFunc("/api/v1/weather", handler.ApiWeatherHandler)
+	http.HandleFunc("/api/v1/cities", handler.ApiCitiesHandler)
+	http.HandleFunc("/api/v1/nearest", handler.ApiNearestHandler)
+	http.HandleFunc("/api/v1/compare", handler.ApiCompareHandler)
+	http.HandleFunc("/api/v1/lucky", handler.ApiLuckyHandler)
 	
 	log.Printf("Go to localhost:8081/")
 	err := http.ListenAndServe(":8081", nil)
@@ -56,6 +108,22 @@ func main() {
 	checkErr("ListenAndServe error", err)
 }
 
+func importCities(source string) {
+	if source == "" {
+		source = helper.CityListUrl
+	}
+
+	log.Printf("Importing cities from %s", source)
+	counts, err := helper.ImportCityList(source)
+	helper.CloseDB()
+	if err != nil {
+		log.Fatalf("City import error> %s", err.Error())
+	}
+
+	log.Printf("Imported %d cities: %d added, %d updated, %d unchanged, %d skipped",
+		counts.Read, counts.Added, counts.Updated, counts.Unchanged, counts.Skipped)
+}
+
 func checkErr(message string, err error) {
 	if err != nil {
 		log.Printf("%s: %s", message, err.Error())
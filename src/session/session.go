@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"settings"
 	"helper"
+	"strings"
 	"time"
 )
 
@@ -70,6 +71,29 @@ func SetSession(w http.ResponseWriter, r *http.Request, username string, passwor
 	helper.CreateSessionHistory(username, sessionKey)
 }
 
+// Create a session for a client of the JSON API. Instead of a cookie, the session key is returned
+// to be sent as a bearer token
+func CreateToken(username string, password string) string {
+	sessionKey := helper.CreateSession(username, password)
+	helper.CreateSessionHistory(username, sessionKey)
+	return sessionKey
+}
+
+// Check to see if the request carries a valid bearer token or session cookie, and return the
+// username it belongs to
+func VerifyApiRequest(w http.ResponseWriter, r *http.Request) (bool, string) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		username := helper.GetSessionUser(strings.TrimPrefix(header, "Bearer "))
+		return username != "", username
+	}
+
+	if isValidSession, _ := VerifySession(w, r); isValidSession {
+		username, _ := ReadCookieHandler(w, r)
+		return true, username
+	}
+	return false, ""
+}
+
 // Periodically clear old sessions (greater than 5 hours)
 func CleanSessions(period time.Duration, quit <- chan struct{}) {
 	timer := time.NewTicker(period)
@@ -5,4 +5,31 @@ const(
 	PEPPER = "c^sJ*C@ll3nge"
 	COOKIEHASHKEY = "78b3e2f483f3a1e6f13b5ca2560217cafd87b0646bce8c6a2885191f48264b21"
 	SESSIONPEPPER = "P*,k@0b+s!m4B"
+	// Current weather is cached until the observation time plus this many minutes
+	WEATHERCACHETTLMINUTES = 10
+	// Most cities on the /compare page and the number of them fetched at the same time
+	COMPAREMAXCITIES = 8
+	COMPAREWORKERS = 4
+	// Stored weather alerts are fetched again after this many minutes, or once one of them ends
+	ALERTSREFRESHMINUTES = 30
+	// A failed alert check is retried after this many minutes, or hours when the key is refused
+	// (e.g. free keys have no access to the One Call API the alerts come from)
+	ALERTSRETRYMINUTES = 10
+	ALERTSDENIEDHOURS = 24
+	// Budgets of the OpenWeatherMap key, every call to it counts. The free tier allows 60 calls a
+	// minute, and the One Call API used for alerts 1,000 a day
+	APIQUOTAPERMINUTE = 60
+	APIQUOTAPERDAY = 1000
+	// When the quota is used up or the weather services fail, expired weather is still shown for
+	// this many hours
+	WEATHERSTALEMAXHOURS = 6
+	// Users who can see the admin pages, separated by commas. Anyone can sign up with any free
+	// username, so list existing users only. Empty, nobody can see them
+	ADMINUSERS = ""
+	// "record" saves every provider response to FIXTUREDIR, "replay" serves them from there without
+	// calling the APIs (e.g. on build machines) and "" calls the APIs. The --fixtures flag overrides it
+	FIXTUREMODE = ""
+	FIXTUREDIR = "fixtures"
+	// SQLite database of the users, cities and weather history, in the server directory
+	DBFILE = "userdb.sqlite"
 )
\ No newline at end of file
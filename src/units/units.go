@@ -0,0 +1,116 @@
+package units
+
+import (
+	"definition"
+	"math"
+)
+
+var (
+	// Default preferences for users who have not chosen any
+	Default = definition.Preferences{Temperature: "metric", WindSpeed: "ms", Pressure: "hpa"}
+
+	temperatureLabels = map[string]string{"metric": "°C", "imperial": "°F", "standard": "K"}
+	windSpeedLabels   = map[string]string{"ms": "m/s", "kmh": "km/h", "mph": "mph", "knots": "kn"}
+	pressureLabels    = map[string]string{"hpa": "hPa", "inhg": "inHg", "mmhg": "mmHg"}
+
+	// Conversion factors from m/s and hPa
+	windSpeedFactors = map[string]float64{"ms": 1, "kmh": 3.6, "mph": 2.236936, "knots": 1.943844}
+	pressureFactors  = map[string]float64{"hpa": 1, "inhg": 0.02953, "mmhg": 0.750062}
+)
+
+// Check that every preference is one of the supported units
+func Valid(prefs definition.Preferences) bool {
+	_, temperatureOk := temperatureLabels[prefs.Temperature]
+	_, windSpeedOk := windSpeedLabels[prefs.WindSpeed]
+	_, pressureOk := pressureLabels[prefs.Pressure]
+	return temperatureOk && windSpeedOk && pressureOk
+}
+
+func Labels(prefs definition.Preferences) *definition.Units {
+	return &definition.Units{
+		Temperature: temperatureLabels[prefs.Temperature],
+		WindSpeed:   windSpeedLabels[prefs.WindSpeed],
+		Pressure:    pressureLabels[prefs.Pressure],
+	}
+}
+
+// Convert metric weather data into the user's preferred units
+func ConvertWeather(reqWeather *definition.CurrentWeather, prefs definition.Preferences) {
+	convertMain(reqWeather.Main, prefs)
+	convertWind(reqWeather.Wind, prefs)
+	convertComfort(reqWeather.Comfort, prefs)
+	reqWeather.Units = Labels(prefs)
+}
+
+func ConvertForecast(forecast *definition.Forecast, prefs definition.Preferences) {
+	for _, item := range forecast.List {
+		convertMain(item.Main, prefs)
+		convertWind(item.Wind, prefs)
+	}
+	forecast.Units = Labels(prefs)
+}
+
+// Convert a temperature in °C
+func Temperature(celsius float32, unit string) float32 {
+	switch unit {
+	case "imperial":
+		return round(float64(celsius)*9/5+32, 1)
+	case "standard":
+		return round(float64(celsius)+273.15, 2)
+	}
+	return celsius
+}
+
+// Convert a wind speed in m/s
+func WindSpeed(metresPerSecond float32, unit string) float32 {
+	if factor, found := windSpeedFactors[unit]; found && unit != "ms" {
+		return round(float64(metresPerSecond)*factor, 1)
+	}
+	return metresPerSecond
+}
+
+// Convert a pressure in hPa
+func Pressure(hectopascals float32, unit string) float32 {
+	if factor, found := pressureFactors[unit]; found && unit != "hpa" {
+		return round(float64(hectopascals)*factor, 2)
+	}
+	return hectopascals
+}
+
+func convertComfort(metrics *definition.Comfort, prefs definition.Preferences) {
+	if metrics == nil {
+		return
+	}
+	metrics.FeelsLike = Temperature(metrics.FeelsLike, prefs.Temperature)
+	metrics.DewPoint = Temperature(metrics.DewPoint, prefs.Temperature)
+	if metrics.HeatIndex != nil {
+		heatIndex := Temperature(*metrics.HeatIndex, prefs.Temperature)
+		metrics.HeatIndex = &heatIndex
+	}
+	if metrics.WindChill != nil {
+		windChill := Temperature(*metrics.WindChill, prefs.Temperature)
+		metrics.WindChill = &windChill
+	}
+}
+
+func convertMain(main *definition.Main, prefs definition.Preferences) {
+	if main == nil {
+		return
+	}
+	main.Temp = Temperature(main.Temp, prefs.Temperature)
+	main.TempMin = Temperature(main.TempMin, prefs.Temperature)
+	main.TempMax = Temperature(main.TempMax, prefs.Temperature)
+	main.Pressure = Pressure(main.Pressure, prefs.Pressure)
+}
+
+func convertWind(wind *definition.Wind, prefs definition.Preferences) {
+	if wind == nil {
+		return
+	}
+	wind.Speed = WindSpeed(wind.Speed, prefs.WindSpeed)
+}
+
+func round(value float64, digits int) float32 {
+	scale := math.Pow(10, float64(digits))
+	return float32(math.Round(value*scale) / scale)
+}